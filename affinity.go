@@ -0,0 +1,135 @@
+package main
+
+import (
+	"fmt"
+	"log"
+	"os/exec"
+	"runtime"
+	"slices"
+
+	"github.com/afq984/BenchmarkV3/systemdetect"
+	"github.com/spf13/pflag"
+)
+
+var (
+	cpuList  string
+	coreType string
+
+	// pinned are the CPUs cmake and ninja are pinned to, or nil for all.
+	pinned []int
+)
+
+func init() {
+	pflag.StringVar(&cpuList, "cpus", "", "run cmake and ninja only on these CPUs, e.g. 0-7,16-23")
+	pflag.StringVar(&coreType, "core-type", "", "run cmake and ninja only on the performance or efficiency cores of a hybrid CPU")
+}
+
+// affinityCPUs returns the CPUs --cpus and --core-type select, or nil if
+// neither is given. With both, only the CPUs in both are used.
+func affinityCPUs() ([]int, error) {
+	var cpus []int
+	if cpuList != "" {
+		var err error
+		cpus, err = systemdetect.ParseCPUList(cpuList)
+		if err != nil {
+			return nil, err
+		}
+	}
+	if coreType == "" {
+		return cpus, nil
+	}
+
+	performance, efficiency, err := systemdetect.CoreTypes()
+	if err != nil {
+		return nil, fmt.Errorf("cannot tell the core types apart: %w", err)
+	}
+	var cores []int
+	switch coreType {
+	case "performance":
+		cores = performance
+	case "efficiency":
+		cores = efficiency
+	default:
+		return nil, fmt.Errorf("unknown core type %q, want performance or efficiency", coreType)
+	}
+	if cpus == nil {
+		return cores, nil
+	}
+	var both []int
+	for _, cpu := range cpus {
+		if slices.Contains(cores, cpu) {
+			both = append(both, cpu)
+		}
+	}
+	if len(both) == 0 {
+		return nil, fmt.Errorf("none of --cpus %s are %s cores", cpuList, coreType)
+	}
+	return both, nil
+}
+
+// pinCPUs makes the commands started from now on, and so cmake, ninja and
+// the compilers they start, run on the CPUs of --cpus and --core-type, and
+// records them in r. This process itself is not pinned, so that the monitors
+// do not take CPU time from the build.
+func pinCPUs(r *Result) error {
+	cpus, err := affinityCPUs()
+	if err != nil || cpus == nil {
+		return err
+	}
+	// Fail now rather than at the first command if cpus cannot be used.
+	err = withAffinity(cpus, func() error { return nil })
+	if err != nil {
+		return fmt.Errorf("cannot set the CPU affinity: %w", err)
+	}
+	pinned = cpus
+	r.Affinity = systemdetect.FormatCPUList(cpus)
+	r.CoreType = coreType
+	log.Println("running cmake and ninja on CPUs", r.Affinity)
+	return nil
+}
+
+// startCmd starts cmd on the pinned CPUs, if any.
+func startCmd(cmd *exec.Cmd) error {
+	if pinned == nil {
+		return cmd.Start()
+	}
+	return withAffinity(pinned, cmd.Start)
+}
+
+// buildCPUs returns the CPUs the builds may run on, as restricted by
+// --cpus, --core-type and --cgroup-cpuset, or nil for all.
+func buildCPUs() []int {
+	cpus := pinned
+	if cgroupCpuset == "" {
+		return cpus
+	}
+	cpuset, err := systemdetect.ParseCPUList(cgroupCpuset)
+	if err != nil {
+		return cpus
+	}
+	if cpus == nil {
+		return cpuset
+	}
+	var both []int
+	for _, cpu := range cpus {
+		if slices.Contains(cpuset, cpu) {
+			both = append(both, cpu)
+		}
+	}
+	return both
+}
+
+func affinityString(r *Result) string {
+	if r.CoreType != "" {
+		return fmt.Sprintf("cpus %s (%s cores)", r.Affinity, r.CoreType)
+	}
+	return "cpus " + r.Affinity
+}
+
+// cpuCount returns the number of CPUs the builds may use.
+func cpuCount() int {
+	if pinned != nil {
+		return len(pinned)
+	}
+	return runtime.NumCPU()
+}
@@ -0,0 +1,38 @@
+package main
+
+import (
+	"runtime"
+
+	"golang.org/x/sys/unix"
+)
+
+// withAffinity runs f on an OS thread pinned to cpus. Child processes
+// inherit the mask of the thread that starts them, so a command started by f
+// runs on cpus while the rest of this process, such as the monitors, keeps
+// the whole machine.
+func withAffinity(cpus []int, f func() error) error {
+	var set unix.CPUSet
+	for _, cpu := range cpus {
+		set.Set(cpu)
+	}
+
+	runtime.LockOSThread()
+	var old unix.CPUSet
+	err := unix.SchedGetaffinity(0, &old)
+	if err != nil {
+		runtime.UnlockOSThread()
+		return err
+	}
+	err = unix.SchedSetaffinity(0, &set)
+	if err != nil {
+		runtime.UnlockOSThread()
+		return err
+	}
+	err = f()
+	// If the old mask cannot be restored, the thread stays locked to this
+	// goroutine so that no other goroutine ends up pinned.
+	if unix.SchedSetaffinity(0, &old) == nil {
+		runtime.UnlockOSThread()
+	}
+	return err
+}
@@ -0,0 +1,9 @@
+//go:build !linux
+
+package main
+
+import "errors"
+
+func withAffinity(cpus []int, f func() error) error {
+	return errors.New("pinning to CPUs is only supported on Linux")
+}
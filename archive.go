@@ -8,6 +8,7 @@ import (
 	"io"
 	"io/fs"
 	"log"
+	"net"
 	"net/http"
 	"net/url"
 	"os"
@@ -15,6 +16,7 @@ import (
 	"path/filepath"
 	"runtime"
 	"strings"
+	"time"
 
 	"github.com/mholt/archiver/v4"
 )
@@ -254,6 +256,11 @@ func (a *Archive) savePath() string {
 	return filepath.Join(downloadDir, path.Base(u.Path))
 }
 
+// String returns the download name of the archive.
+func (a *Archive) String() string {
+	return filepath.Base(a.savePath())
+}
+
 // check that the downloaded archive matches the specified checksum
 func (a *Archive) check(ctx context.Context) error {
 	f, err := os.Open(a.savePath())
@@ -286,11 +293,20 @@ func (a *Archive) downloadWithoutChecks(ctx context.Context) error {
 		return err
 	}
 
+	ctx, cancelTimeout := phaseContext(ctx, "download", downloadTimeout)
+	defer cancelTimeout()
+	ctx, cancel := context.WithCancelCause(ctx)
+	defer cancel(nil)
+	idle := time.AfterFunc(downloadIdleTimeout, func() {
+		cancel(fmt.Errorf("download of %s received no data for %v", a.URL, downloadIdleTimeout))
+	})
+	defer idle.Stop()
+
 	req, err := http.NewRequestWithContext(ctx, http.MethodGet, a.URL, nil)
 	if err != nil {
 		panic(err)
 	}
-	resp, err := http.DefaultClient.Do(req)
+	resp, err := httpClient.Do(req)
 	if err != nil {
 		return err
 	}
@@ -306,16 +322,43 @@ func (a *Archive) downloadWithoutChecks(ctx context.Context) error {
 	}
 	defer f.Close()
 
-	_, err = io.Copy(f, resp.Body)
-	if err != nil {
-		return err
-	}
+	_, err = io.Copy(f, &idleReader{r: resp.Body, timer: idle})
+	return phaseError(ctx, err)
+}
 
-	return nil
+// httpClient gives up on servers that do not answer; a transfer that stops
+// midway is caught by idleReader.
+var httpClient = &http.Client{
+	Transport: &http.Transport{
+		Proxy: http.ProxyFromEnvironment,
+		DialContext: (&net.Dialer{
+			Timeout:   30 * time.Second,
+			KeepAlive: 30 * time.Second,
+		}).DialContext,
+		TLSHandshakeTimeout:   30 * time.Second,
+		ResponseHeaderTimeout: time.Minute,
+	},
+}
+
+// downloadIdleTimeout is how long a download may receive no data at all.
+const downloadIdleTimeout = time.Minute
+
+// idleReader resets timer whenever data arrives.
+type idleReader struct {
+	r     io.Reader
+	timer *time.Timer
+}
+
+func (r *idleReader) Read(p []byte) (int, error) {
+	n, err := r.r.Read(p)
+	if n > 0 {
+		r.timer.Reset(downloadIdleTimeout)
+	}
+	return n, err
 }
 
-func (a *Archive) downloadWithChecks(ctx context.Context) error {
-	err := a.check(ctx)
+func (a *Archive) downloadWithChecks(ctx context.Context, t *PackageTimes) error {
+	err := timed(&t.Check, func() error { return a.check(ctx) })
 	if err == nil {
 		return nil
 	}
@@ -327,13 +370,13 @@ func (a *Archive) downloadWithChecks(ctx context.Context) error {
 		log.Printf("redownloading %s (%s)", a.savePath(), err)
 	}
 
-	err = a.downloadWithoutChecks(ctx)
+	err = timed(&t.Download, func() error { return a.downloadWithoutChecks(ctx) })
 	if err != nil {
 		log.Println("download failed:", err)
 		return err
 	}
 
-	err = a.check(ctx)
+	err = timed(&t.Check, func() error { return a.check(ctx) })
 	if err != nil {
 		log.Println("download failed:", err)
 		return err
@@ -342,18 +385,28 @@ func (a *Archive) downloadWithChecks(ctx context.Context) error {
 	return nil
 }
 
-func (a *Archive) DownloadAndExtract(ctx context.Context, buildDir string) error {
-	err := a.downloadWithChecks(ctx)
+func (a *Archive) DownloadAndExtract(ctx context.Context, buildDir string, t *PackageTimes) error {
+	err := a.downloadWithChecks(ctx, t)
 	if err != nil {
 		return err
 	}
 
+	fi, err := os.Stat(a.savePath())
+	if err != nil {
+		return err
+	}
+	t.Size = fi.Size()
+
 	log.Println("extracting:", a.savePath())
 	extractTo := buildDir
 	if a.ExtractTo != "" {
 		extractTo = filepath.Join(extractTo, a.ExtractTo)
 	}
-	err = unarchive(ctx, a.savePath(), extractTo, a.Keep)
+	err = timed(&t.Extract, func() error {
+		ctx, cancel := phaseContext(ctx, "extract", extractTimeout)
+		defer cancel()
+		return phaseError(ctx, unarchive(ctx, a.savePath(), extractTo, a.Keep))
+	})
 	if err != nil {
 		log.Println("extract failed:", err)
 		return err
@@ -362,6 +415,6 @@ func (a *Archive) DownloadAndExtract(ctx context.Context, buildDir string) error
 	return nil
 }
 
-func (a *Archive) SetUp(ctx context.Context, buildDir string) error {
-	return a.DownloadAndExtract(ctx, buildDir)
+func (a *Archive) SetUp(ctx context.Context, buildDir string, t *PackageTimes) error {
+	return a.DownloadAndExtract(ctx, buildDir, t)
 }
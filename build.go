@@ -3,6 +3,8 @@ package main
 import (
 	"context"
 	_ "embed"
+	"errors"
+	"fmt"
 	"io/ioutil"
 	"log"
 	"os"
@@ -10,9 +12,12 @@ import (
 	"os/signal"
 	"path/filepath"
 	"runtime"
+	"strconv"
+	"strings"
 	"sync"
 	"time"
 
+	"github.com/afq984/BenchmarkV3/systemdetect"
 	"github.com/spf13/pflag"
 )
 
@@ -21,25 +26,68 @@ var toolchainContents []byte
 
 const toolchainFileName = "toolchain.cmake"
 
-var quick bool
+var (
+	runs          int
+	configureRuns int
+	workDir       string
+	downloadDir   string
+	keep          bool
+	reuseDir      string
+)
 
 func init() {
-	pflag.BoolVar(&quick, "quick", false, "do a quick build to check configuration")
+	pflag.IntVar(&runs, "runs", 1, "number of timed builds; the tree is cleaned between them")
+	pflag.IntVar(&configureRuns, "configure-runs", 0, "also time this many cmake configures, each in a fresh output directory")
+	pflag.StringVar(&workDir, "work-dir", ".", "directory to create the build tree in")
+	pflag.StringVar(&downloadDir, "download-dir", "dl", "directory to keep downloaded archives in")
+	pflag.BoolVar(&keep, "keep", false, "keep the configured build tree for --reuse")
+	pflag.StringVar(&reuseDir, "reuse", "", "time builds in this tree from an earlier --keep run instead of setting up a new one")
 }
 
-func run(env []string, name string, args ...string) error {
-	cmd := exec.Command(
+// commandWaitDelay is how long Wait waits for the output of a command after
+// it exited or was killed.
+const commandWaitDelay = 10 * time.Second
+
+// command prepares a command that inherits our output and environment, with
+// env added.
+func command(ctx context.Context, env []string, name string, args ...string) *exec.Cmd {
+	cmd := exec.CommandContext(
+		ctx,
 		name,
 		args...,
 	)
+	// Killing only the command would leave the compilers ninja started
+	// running in the build directory, so the whole process tree is stopped
+	// when ctx is done.
+	setProcessGroup(cmd)
+	cmd.Cancel = func() error {
+		// A timeout, unlike an interrupt, needs to show what was stuck.
+		if cause := context.Cause(ctx); !errors.Is(cause, context.Canceled) {
+			log.Printf("killing %s: %v; running processes:", cmd, cause)
+			dumpProcesses(cmd)
+		}
+		return killProcessTree(cmd)
+	}
+	// The output may go through pipes, which a grandchild that survived
+	// the kill could keep open forever.
+	cmd.WaitDelay = commandWaitDelay
 	cmd.Stdout = os.Stdout
 	cmd.Stderr = os.Stderr
 	if len(env) > 0 {
 		cmd.Env = append(os.Environ(), env...)
 	}
+	return cmd
+}
+
+// runCmd runs cmd on the pinned CPUs and logs it. Afterwards
+// cmd.ProcessState holds the exit status and resource usage.
+func runCmd(cmd *exec.Cmd) error {
 	log.Println("running:", cmd)
 
-	err := cmd.Run()
+	err := startCmd(cmd)
+	if err == nil {
+		err = cmd.Wait()
+	}
 	if err != nil {
 		log.Println("command failed:", cmd)
 		log.Println(err)
@@ -60,7 +108,7 @@ func DownloadOnly(c *Config) error {
 		if a, ok := p.(*Archive); ok {
 			count++
 			go func(a *Archive) {
-				errs <- a.downloadWithChecks(ctx)
+				errs <- a.downloadWithChecks(ctx, &PackageTimes{})
 			}(a)
 		}
 	}
@@ -76,45 +124,244 @@ func DownloadOnly(c *Config) error {
 	return err
 }
 
-func Build(c *Config) (time.Duration, error) {
-	var buildDir string
-	var err error
+// builder is a build tree that has been set up and configured.
+type builder struct {
+	// ctx stops every command the builder runs when it is done.
+	ctx context.Context
+	c   *Config
+	t   *Track
+	dir string
+	env []string
+	// out is the cmake output directory, relative to dir.
+	out string
+	// cgroup limits the timed builds, if set.
+	cgroup *cgroup
+	// logs keeps the output of the commands.
+	logs *commandLogs
 
-	ctx, cancel := context.WithCancel(context.Background())
-	defer cancel()
-	ctx, stop := signal.NotifyContext(ctx, os.Interrupt)
-	defer stop()
+	// built is set once a build has run, so the next clean build must clean
+	// first.
+	built bool
+}
 
-	buildDir, err = ioutil.TempDir(".", "build.*")
+// absPath returns the absolute path of rel, which is relative to the build
+// directory.
+func (b *builder) absPath(rel string) string {
+	p, err := filepath.Abs(filepath.Join(b.dir, rel))
 	if err != nil {
-		log.Println("failed to create build directory")
-		return 0, err
+		panic(err)
 	}
-	defer func() {
-		log.Println("cleaning up", buildDir)
-		os.RemoveAll(buildDir)
-	}()
-	log.Println("using build directory:", buildDir)
+	return p
+}
+
+// run runs cmd with its output logged to the log of phase.
+func (b *builder) run(cmd *exec.Cmd, phase string) error {
+	if b.logs == nil {
+		return runCmd(cmd)
+	}
+	return b.logs.run(cmd, phase)
+}
+
+// logName returns the name of the log of phase for the tree in b.out; the
+// trees of --throughput each get their own.
+func (b *builder) logName(phase string) string {
+	if b.out == "out" {
+		return phase
+	}
+	return b.out + "." + phase
+}
+
+// ninja runs the bundled ninja in the cmake output directory.
+func (b *builder) ninja(args ...string) error {
+	return b.run(b.ninjaCmd(args...), b.logName("build"))
+}
+
+func (b *builder) ninjaCmd(args ...string) *exec.Cmd {
+	return b.ninjaCmdContext(b.ctx, args...)
+}
+
+func (b *builder) ninjaCmdContext(ctx context.Context, args ...string) *exec.Cmd {
+	return command(
+		ctx,
+		b.env,
+		b.absPath(b.c.Ninja()),
+		append([]string{"-C", b.absPath(b.out)}, args...)...,
+	)
+}
+
+// ninjaOutput runs the bundled ninja in the cmake output directory and
+// returns its standard output.
+func (b *builder) ninjaOutput(args ...string) ([]byte, error) {
+	cmd := b.ninjaCmd(args...)
+	cmd.Stdout = nil
+	return cmd.Output()
+}
+
+// clean removes every output of the previous build, but keeps the cmake
+// configuration, so that the next build starts from the same state as the
+// first one.
+func (b *builder) clean() error {
+	return b.ninja("-t", "clean")
+}
+
+// cleanBuild builds targets from a clean state and records how long it took.
+// jobs is passed to ninja as -j; 0 keeps ninja's default.
+func (b *builder) cleanBuild(targets []string, jobs int) (*Sample, error) {
+	if b.built {
+		err := b.clean()
+		if err != nil {
+			return nil, err
+		}
+	}
+	return b.timedBuild(targets, jobs)
+}
+
+// timedBuild brings targets up to date and records how long it took.
+func (b *builder) timedBuild(targets []string, jobs int) (*Sample, error) {
+	nb, err := b.prepareBuild(targets, jobs)
+	if err != nil {
+		return nil, err
+	}
+	stop := watch(monitors(b), sampleInterval)
+	s, err := nb.run()
+	stop(s)
+	if err != nil {
+		return nil, err
+	}
+	nb.profile(s)
+	return s, nil
+}
+
+// ninjaBuild is a build of targets in b that is ready to be timed.
+type ninjaBuild struct {
+	b       *builder
+	targets []string
+	jobs    int
+	// logSize is where the steps of the build start in .ninja_log.
+	logSize int64
+}
+
+// prepareBuild does the untimed work before a timed build of targets.
+func (b *builder) prepareBuild(targets []string, jobs int) (*ninjaBuild, error) {
+	b.built = true
+	if jobs == 0 {
+		jobs = defaultJobs()
+	}
+
+	// Only the steps this build appends to .ninja_log are profiled. Compact
+	// the log first, as ninja would otherwise be free to rewrite it when the
+	// build starts.
+	logSize, err := b.ninjaLogSize()
+	if err != nil {
+		return nil, err
+	}
+	if logSize > 0 {
+		err = b.ninja("-t", "recompact")
+		if err != nil {
+			return nil, err
+		}
+		logSize, err = b.ninjaLogSize()
+		if err != nil {
+			return nil, err
+		}
+	}
+	return &ninjaBuild{b: b, targets: targets, jobs: jobs, logSize: logSize}, nil
+}
+
+// run runs the build and returns a Sample with its time, which is set even
+// if the build failed. The caller runs the monitors.
+func (nb *ninjaBuild) run() (*Sample, error) {
+	b := nb.b
+	var args []string
+	if nb.jobs > 0 {
+		args = append(args, "-j", strconv.Itoa(nb.jobs))
+	}
+	args = append(args, nb.targets...)
+
+	ctx, cancelTimeout := phaseContext(b.ctx, "build", buildTimeout)
+	defer cancelTimeout()
+	ctx, cancel := context.WithCancelCause(ctx)
+	defer cancel(nil)
+	stopWatchdog := watchProgress(ctx, cancel, b.ninjaLogSize, stallTimeout)
+
+	cmd := b.ninjaCmdContext(ctx, args...)
+	if b.cgroup != nil {
+		b.cgroup.enter(cmd)
+	}
+	oom := readOOMKills(b.cgroup)
+	t0 := time.Now()
+	err := b.run(cmd, b.logName("build"))
+	t1 := time.Now()
+	stopWatchdog()
+	s := &Sample{Jobs: nb.jobs, Time: t1.Sub(t0).Seconds()}
+	if err != nil {
+		if ctx.Err() != nil {
+			// ninja was killed because the benchmark was interrupted or
+			// the build timed out. The cgroup catches any process that
+			// escaped the process tree.
+			if b.cgroup != nil {
+				b.cgroup.kill()
+			}
+			return s, phaseError(ctx, err)
+		}
+		if msg := diagnoseOOM(b.cgroup, oom, cmd.ProcessState, nb.jobs); msg != "" {
+			log.Println(msg)
+			return s, fmt.Errorf("%s: %w", msg, err)
+		}
+		return s, err
+	}
+	s.Rusage = rusage(cmd.ProcessState)
+	return s, nil
+}
 
-	buildAbsPath := func(rel string) string {
-		p, err := filepath.Abs(filepath.Join(buildDir, rel))
+// profile adds the profile of the finished build to s. The profile is
+// informational, so failing to make one only gets logged.
+func (nb *ninjaBuild) profile(s *Sample) {
+	var err error
+	s.Profile, err = nb.b.profile(nb.targets, nb.logSize)
+	if err != nil {
+		log.Println("cannot profile the build:", err)
+	}
+}
+
+// timedBuilds runs cleanBuild n times and returns every sample.
+func (b *builder) timedBuilds(targets []string, jobs, n int) ([]*Sample, error) {
+	var samples []*Sample
+	for i := 0; i < n; i++ {
+		if n > 1 {
+			log.Printf("timed build %d of %d", i+1, n)
+		}
+		s, err := b.cleanBuild(targets, jobs)
 		if err != nil {
-			panic(err)
+			return nil, err
 		}
-		return p
+		samples = append(samples, s)
 	}
+	return samples, nil
+}
+
+// setUp downloads and extracts the packages into the build directory in
+// parallel, and then prepares the toolchain.
+func (b *builder) setUp(ctx context.Context, cancel context.CancelFunc, r *Result) error {
+	c := b.c
+	var err error
 
 	// parallel download and extract
 	{
+		t0 := time.Now()
+		setup := &Sample{}
+		stop := watch([]monitor{newDiskMonitor(b.dir)}, sampleInterval)
 		errMux := sync.Mutex{}
 		wg := sync.WaitGroup{}
 		wg.Add(len(c.Packages()))
 
 		for _, p := range c.Packages() {
+			t := &PackageTimes{}
+			r.Phases.Packages[p.String()] = t
 			go func(p Package) {
 				defer wg.Done()
 
-				lerr := p.SetUp(ctx, buildDir)
+				lerr := p.SetUp(ctx, b.dir, t)
 				if lerr != nil {
 					errMux.Lock()
 					defer errMux.Unlock()
@@ -126,16 +373,20 @@ func Build(c *Config) (time.Duration, error) {
 		}
 
 		wg.Wait()
+		stop(setup)
 		if err != nil {
-			return 0, err
+			return err
 		}
+		r.Phases.SetUp = time.Since(t0).Seconds()
+		r.Phases.SetUpDisk = setup.Disk
 	}
 
+	t0 := time.Now()
 	log.Println("writing", toolchainFileName)
-	err = os.WriteFile(filepath.Join(buildDir, toolchainFileName), toolchainContents, 0644)
+	err = os.WriteFile(filepath.Join(b.dir, toolchainFileName), toolchainContents, 0644)
 	if err != nil {
 		log.Println("failed to write toolchain.cmake:", err)
-		return 0, err
+		return err
 	}
 
 	// A stable "clang-bin" path lets the cmake toolchain file stay static. A
@@ -143,62 +394,287 @@ func Build(c *Config) (time.Duration, error) {
 	// junction there (which does not); a relative symlink elsewhere.
 	if runtime.GOOS == "windows" {
 		err = exec.Command("cmd", "/c", "mklink", "/J",
-			buildAbsPath("clang-bin"), buildAbsPath(c.ClangBin)).Run()
+			b.absPath("clang-bin"), b.absPath(c.ClangBin)).Run()
 	} else {
-		err = os.Symlink(c.ClangBin, filepath.Join(buildDir, "clang-bin"))
+		err = os.Symlink(c.ClangBin, filepath.Join(b.dir, "clang-bin"))
 	}
 	if err != nil {
 		log.Println("cannot create clang-bin link")
-		return 0, err
+		return err
 	}
 
+	err = b.setUpEnv()
+	if err != nil {
+		return err
+	}
+	r.Phases.Toolchain = time.Since(t0).Seconds()
+	return nil
+}
+
+// setUpEnv sets the environment the toolchain needs to run.
+func (b *builder) setUpEnv() error {
 	// The toolchain's lld lists libxml2.so.2 as NEEDED but never calls it for
 	// ELF linking. If the host lacks it, provide a stub via LD_LIBRARY_PATH so
 	// cmake's compiler checks and the build can link. When the host already has
 	// a (versioned) libxml2.so.2 we must not interpose, so this probes lld first.
-	buildEnv, err := libxml2StubEnv(buildDir, buildAbsPath(filepath.Join("clang-bin", "lld")))
+	var err error
+	b.env, err = libxml2StubEnv(b.dir, b.absPath(filepath.Join("clang-bin", "lld")))
 	if err != nil {
 		log.Println("failed to set up libxml2 stub:", err)
-		return 0, err
 	}
+	return err
+}
 
+// cmakeArgs returns the arguments that configure the tree into out, relative
+// to the build directory.
+func (b *builder) cmakeArgs(out string) []string {
+	c := b.c
 	cmakeArgs := []string{
-		"-B", buildAbsPath("out"),
-		"-S", buildAbsPath(c.LLVMSrc),
+		"-B", b.absPath(out),
+		"-S", b.absPath(c.LLVMSrc),
 		"-G", "Ninja",
-		"-DCMAKE_MAKE_PROGRAM=" + buildAbsPath(c.Ninja()),
-		"-DCMAKE_TOOLCHAIN_FILE=" + buildAbsPath(toolchainFileName),
-		"-DCMAKE_BUILD_TYPE=Release", // debug builds sadly take too much disk space
+		"-DCMAKE_MAKE_PROGRAM=" + b.absPath(c.Ninja()),
+		"-DCMAKE_TOOLCHAIN_FILE=" + b.absPath(toolchainFileName),
+		"-DCMAKE_BUILD_TYPE=Release", // debug info only in the debug track; it takes too much disk space
 		"-DLLVM_ENABLE_PROJECTS=",
-		"-DLLVM_TABLEGEN=" + buildAbsPath(c.LLVMTblgen()),
+		"-DLLVM_TABLEGEN=" + b.absPath(c.LLVMTblgen()),
 		"-DLLVM_TARGETS_TO_BUILD=X86",
 	}
 	if c.Python != "" {
-		cmakeArgs = append(cmakeArgs, "-DPython3_EXECUTABLE="+buildAbsPath(c.Python))
+		cmakeArgs = append(cmakeArgs, "-DPython3_EXECUTABLE="+b.absPath(c.Python))
 	}
 	cmakeArgs = append(cmakeArgs, c.CmakeArgs...)
-	err = run(buildEnv, buildAbsPath(c.Cmake()), cmakeArgs...)
+	// cmake keeps the last value given for a variable, so the track's
+	// arguments override the defaults above.
+	for _, arg := range b.t.CmakeArgs {
+		cmakeArgs = append(cmakeArgs, os.Expand(arg, b.toolPath))
+	}
+	return cmakeArgs
+}
+
+// toolPath returns the path of tool in the toolchain's bin directory.
+func (b *builder) toolPath(tool string) string {
+	return b.absPath(exe(filepath.Join(b.c.ClangBin, tool)))
+}
+
+// checkTools makes sure that the tools the track's cmake arguments refer to
+// exist, as cmake would only fail on a missing one deep into the build.
+func (b *builder) checkTools() error {
+	for _, arg := range b.t.CmakeArgs {
+		var missing []string
+		os.Expand(arg, func(tool string) string {
+			path := b.toolPath(tool)
+			if _, err := os.Stat(path); err != nil {
+				missing = append(missing, path)
+			}
+			return path
+		})
+		if len(missing) > 0 {
+			return fmt.Errorf("cmake argument %s needs %s, which the toolchain does not have",
+				arg, strings.Join(missing, ", "))
+		}
+	}
+	return nil
+}
+
+// configure runs cmake to configure the tree into out, relative to the build
+// directory.
+func (b *builder) configure(out string) error {
+	err := b.checkTools()
 	if err != nil {
-		return 0, err
+		log.Println(err)
+		return err
 	}
+	ctx, cancel := phaseContext(b.ctx, "configure", configureTimeout)
+	defer cancel()
+	err = b.run(command(ctx, b.env, b.absPath(b.c.Cmake()), b.cmakeArgs(out)...), "configure")
+	return phaseError(ctx, err)
+}
 
-	t0 := time.Now()
-	buildTarget := "llc"
-	if quick {
-		buildTarget = "llvm-cxxfilt"
-	}
-	err = run(
-		buildEnv,
-		buildAbsPath(c.Ninja()),
-		"-C", buildAbsPath("out"),
-		buildTarget,
-	)
-	t1 := time.Now()
+// timedConfigures times --configure-runs configures, each into a fresh
+// output directory next to b.out, so that every try_compile probe runs again.
+func (b *builder) timedConfigures(r *Result) error {
+	out := b.out + ".configure"
+	defer os.RemoveAll(b.absPath(out))
+	for i := 0; i < configureRuns; i++ {
+		log.Printf("timed configure %d of %d", i+1, configureRuns)
+		err := os.RemoveAll(b.absPath(out))
+		if err != nil {
+			return err
+		}
+		var t float64
+		err = timed(&t, func() error {
+			return b.configure(out)
+		})
+		if err != nil {
+			return err
+		}
+		r.Phases.ConfigureRuns = append(r.Phases.ConfigureRuns, t)
+	}
+	return nil
+}
+
+// errInterrupted is returned by Build when it was stopped with Ctrl-C.
+var errInterrupted = errors.New("interrupted")
+
+// Build sets up and configures a build tree for c, runs the timed builds of
+// track t and stores their measurements in r. With --reuse, an existing tree
+// set up by an earlier --keep run is used instead.
+func Build(c *Config, t *Track, r *Result) (err error) {
+	var buildDir string
+
+	interrupt, stop := signal.NotifyContext(context.Background(), os.Interrupt)
+	defer stop()
+	ctx, cancel := context.WithCancel(interrupt)
+	defer cancel()
+	// Deferred first so that it runs last, once every command has been
+	// killed and waited for and the build directory has been removed.
+	defer func() {
+		if err != nil && interrupt.Err() != nil {
+			err = errInterrupted
+		}
+	}()
+
+	if reuseDir != "" {
+		buildDir = reuseDir
+		log.Println("reusing build directory:", buildDir)
+	} else {
+		err = os.MkdirAll(workDir, 0755)
+		if err != nil {
+			log.Println("failed to create work directory:", err)
+			return err
+		}
+		buildDir, err = ioutil.TempDir(workDir, "build.*")
+		if err != nil {
+			log.Println("failed to create build directory")
+			return err
+		}
+		defer func() {
+			if keep {
+				log.Printf("keeping %s; run again with --reuse %s to skip setting it up", buildDir, buildDir)
+				return
+			}
+			log.Println("cleaning up", buildDir)
+			os.RemoveAll(buildDir)
+		}()
+		log.Println("using build directory:", buildDir)
+	}
+
+	r.WorkDir, err = filepath.Abs(filepath.Dir(buildDir))
+	if err != nil {
+		return err
+	}
+	r.Filesystem, err = systemdetect.Filesystem(buildDir)
+	if err != nil {
+		log.Println("cannot detect the filesystem of the build directory:", err)
+		r.Filesystem = unknown
+	}
+	log.Printf("build directory is on %s", r.Filesystem)
+
+	if t.MinFree > 0 {
+		free, err := systemdetect.DiskFree(buildDir)
+		if err != nil {
+			log.Println("cannot check free disk space:", err)
+		} else if free < t.MinFree {
+			err = fmt.Errorf("%.1f GiB free in %s, the track needs at least %.1f GiB; use --work-dir to build elsewhere",
+				float64(free)/(1<<30), r.WorkDir, float64(t.MinFree)/(1<<30))
+			log.Println("not enough disk space:", err)
+			return err
+		}
+	}
+
+	c = c.withSource(t.Source)
+	b := &builder{ctx: ctx, c: c, t: t, dir: buildDir, out: "out"}
+	b.logs, err = newCommandLogs(buildDir)
+	if err != nil {
+		log.Println("cannot create the log directory:", err)
+		return err
+	}
+	defer b.logs.close()
+	log.Println("writing the output of cmake and ninja to", b.logs.dir)
+	r.Phases = &Phases{Packages: map[string]*PackageTimes{}}
+
+	if reuseDir != "" {
+		err = b.checkManifest()
+		if err != nil {
+			log.Println("cannot reuse build directory:", err)
+			return err
+		}
+		err = b.setUpEnv()
+		if err != nil {
+			return err
+		}
+		err = pinCPUs(r)
+		if err != nil {
+			log.Println(err)
+			return err
+		}
+		// The tree may hold the outputs of an earlier build.
+		b.built = true
+		r.Phases.Reused = true
+	} else {
+		err = b.setUp(ctx, cancel, r)
+		if err != nil {
+			return err
+		}
+		err = pinCPUs(r)
+		if err != nil {
+			log.Println(err)
+			return err
+		}
+
+		err = timed(&r.Phases.Configure, func() error {
+			return b.configure(b.out)
+		})
+		if err != nil {
+			return err
+		}
+
+		err = b.writeManifest()
+		if err != nil {
+			log.Println("failed to write tree manifest:", err)
+			return err
+		}
+	}
+
+	if l := cgroupLimits(); l != nil {
+		b.cgroup, err = newCgroup(l)
+		if err != nil {
+			log.Println("cannot set up the cgroup:", err)
+			return err
+		}
+		defer b.cgroup.remove()
+		r.Limits = l
+		log.Println("timed builds run in", l)
+	}
+
+	err = b.timedConfigures(r)
 	if err != nil {
-		return 0, err
+		return err
 	}
 
-	dt := t1.Sub(t0)
+	if sweep {
+		err = sweepJobs(b, t.Targets, r)
+	} else if throughputBuilds > 1 {
+		err = measureThroughput(b, t.Targets, r)
+	} else {
+		err = t.measure(b, r)
+	}
+	if err != nil {
+		return err
+	}
+	if r.Throughput != nil {
+		// The builds of a round ran at the same time.
+		for _, s := range r.Throughput.Rounds {
+			r.Phases.Build += s.Time
+		}
+		r.Pressure = totalPressure(r.Throughput.Rounds)
+	} else {
+		for _, s := range r.Samples {
+			r.Phases.Build += s.Time
+		}
+		r.Pressure = totalPressure(r.Samples)
+	}
 
-	return dt, nil
+	return nil
 }
@@ -0,0 +1,73 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/spf13/pflag"
+)
+
+var (
+	cgroupCPUs   float64
+	cgroupCpuset string
+	cgroupMemory float64
+)
+
+func init() {
+	pflag.Float64Var(&cgroupCPUs, "cgroup-cpus", 0, "run the timed builds in a cgroup limited to this many CPUs of time (cpu.max)")
+	pflag.StringVar(&cgroupCpuset, "cgroup-cpuset", "", "run the timed builds in a cgroup limited to these CPUs, e.g. 0-7 (cpuset.cpus)")
+	pflag.Float64Var(&cgroupMemory, "cgroup-memory", 0, "run the timed builds in a cgroup limited to this many GiB of memory (memory.max)")
+}
+
+// Limits are the cgroup v2 limits the timed builds ran under, to emulate a
+// smaller machine on a big one.
+type Limits struct {
+	// CPUs is the cpu.max quota in CPUs; 0 means unlimited.
+	CPUs float64 `json:"cpus,omitempty"`
+	// Cpuset is cpuset.cpus, the CPUs the build may run on.
+	Cpuset string `json:"cpuset,omitempty"`
+	// Memory is memory.max in bytes; 0 means unlimited.
+	Memory int64 `json:"memory,omitempty"`
+}
+
+// cgroupLimits returns the limits given on the command line, or nil if there
+// are none.
+func cgroupLimits() *Limits {
+	if cgroupCPUs <= 0 && cgroupCpuset == "" && cgroupMemory <= 0 {
+		return nil
+	}
+	return &Limits{
+		CPUs:   max(cgroupCPUs, 0),
+		Cpuset: cgroupCpuset,
+		Memory: int64(max(cgroupMemory, 0) * (1 << 30)),
+	}
+}
+
+// controllers returns the cgroup controllers that enforce l.
+func (l *Limits) controllers() []string {
+	var cs []string
+	if l.CPUs > 0 {
+		cs = append(cs, "cpu")
+	}
+	if l.Cpuset != "" {
+		cs = append(cs, "cpuset")
+	}
+	if l.Memory > 0 {
+		cs = append(cs, "memory")
+	}
+	return cs
+}
+
+func (l *Limits) String() string {
+	var s []string
+	if l.CPUs > 0 {
+		s = append(s, fmt.Sprintf("%g CPUs", l.CPUs))
+	}
+	if l.Cpuset != "" {
+		s = append(s, "cpuset "+l.Cpuset)
+	}
+	if l.Memory > 0 {
+		s = append(s, fmt.Sprintf("%.1f GiB", float64(l.Memory)/(1<<30)))
+	}
+	return "cgroup: " + strings.Join(s, ", ")
+}
@@ -0,0 +1,173 @@
+package main
+
+import (
+	"fmt"
+	"log"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"slices"
+	"strconv"
+	"strings"
+	"syscall"
+)
+
+// cgroup is a child cgroup v2 with Limits that the timed builds run in.
+type cgroup struct {
+	dir string
+	fd  *os.File
+
+	// parent is the cgroup this process was started in, leaf the one it
+	// moved to, and enabled the controllers it enabled in parent, so that
+	// remove can undo all of it.
+	parent  string
+	leaf    string
+	enabled []string
+}
+
+// cgroupPeriod is the cpu.max period in microseconds.
+const cgroupPeriod = 100000
+
+// newCgroup creates a cgroup with limits l below the one this process is in,
+// which must be delegated to the user, e.g. by running the benchmark with
+// systemd-run --user --scope -p Delegate=yes.
+func newCgroup(l *Limits) (*cgroup, error) {
+	parent, err := ownCgroup()
+	if err != nil {
+		return nil, err
+	}
+	b, err := os.ReadFile(filepath.Join(parent, "cgroup.subtree_control"))
+	if err != nil {
+		return nil, err
+	}
+	active := strings.Fields(string(b))
+
+	// Once controllers are enabled for its children, a cgroup cannot hold
+	// processes itself, so this process moves into a leaf of its own.
+	cg := &cgroup{parent: parent, leaf: filepath.Join(parent, "benchmark.main")}
+	err = os.Mkdir(cg.leaf, 0755)
+	if err != nil && !os.IsExist(err) {
+		return nil, fmt.Errorf("cannot create a cgroup in %s, is it delegated? %w", parent, err)
+	}
+	err = writeCgroup(cg.leaf, "cgroup.procs", strconv.Itoa(os.Getpid()))
+	if err != nil {
+		cg.remove()
+		return nil, err
+	}
+	for _, c := range l.controllers() {
+		if slices.Contains(active, c) {
+			continue
+		}
+		err = writeCgroup(parent, "cgroup.subtree_control", "+"+c)
+		if err != nil {
+			cg.remove()
+			return nil, fmt.Errorf("cannot enable the %s controller, is it delegated? %w", c, err)
+		}
+		cg.enabled = append(cg.enabled, c)
+	}
+
+	dir := filepath.Join(parent, fmt.Sprintf("benchmark.build.%d", os.Getpid()))
+	err = os.Mkdir(dir, 0755)
+	if err != nil {
+		cg.remove()
+		return nil, err
+	}
+	cg.dir = dir
+	err = cg.limit(l)
+	if err == nil {
+		cg.fd, err = os.Open(dir)
+	}
+	if err != nil {
+		cg.remove()
+		return nil, err
+	}
+	return cg, nil
+}
+
+func (cg *cgroup) limit(l *Limits) error {
+	if l.CPUs > 0 {
+		quota := int64(l.CPUs * cgroupPeriod)
+		err := writeCgroup(cg.dir, "cpu.max", fmt.Sprintf("%d %d", quota, cgroupPeriod))
+		if err != nil {
+			return err
+		}
+	}
+	if l.Cpuset != "" {
+		err := writeCgroup(cg.dir, "cpuset.cpus", l.Cpuset)
+		if err != nil {
+			return err
+		}
+	}
+	if l.Memory > 0 {
+		err := writeCgroup(cg.dir, "memory.max", strconv.FormatInt(l.Memory, 10))
+		if err != nil {
+			return err
+		}
+		// The emulated machine has no more memory than the limit, so the
+		// build must not spill into the host's swap. Not every kernel has
+		// swap accounting.
+		writeCgroup(cg.dir, "memory.swap.max", "0")
+	}
+	return nil
+}
+
+func writeCgroup(dir, file, value string) error {
+	err := os.WriteFile(filepath.Join(dir, file), []byte(value), 0)
+	if err != nil {
+		return fmt.Errorf("cannot write %q to %s: %w", value, filepath.Join(dir, file), err)
+	}
+	return nil
+}
+
+// enter makes cmd start inside the cgroup, so that every process of the
+// build is limited from the start.
+func (cg *cgroup) enter(cmd *exec.Cmd) {
+	if cmd.SysProcAttr == nil {
+		cmd.SysProcAttr = &syscall.SysProcAttr{}
+	}
+	cmd.SysProcAttr.UseCgroupFD = true
+	cmd.SysProcAttr.CgroupFD = int(cg.fd.Fd())
+}
+
+// kill kills every process left in the cgroup. cgroup.kill needs Linux 5.14,
+// so it is a best effort.
+func (cg *cgroup) kill() {
+	err := writeCgroup(cg.dir, "cgroup.kill", "1")
+	if err != nil {
+		log.Println(err)
+	}
+}
+
+// remove deletes the cgroup once the builds are done and puts everything
+// back the way it was: the controllers this process enabled are disabled
+// again, which lets it move back to the cgroup it was started in, and
+// benchmark.main is removed. Failures are logged, not fatal, as the results
+// do not depend on them.
+func (cg *cgroup) remove() {
+	if cg.fd != nil {
+		cg.fd.Close()
+	}
+	if cg.dir != "" {
+		err := os.Remove(cg.dir)
+		if err != nil {
+			log.Println("cannot remove cgroup:", err)
+		}
+	}
+	for _, c := range slices.Backward(cg.enabled) {
+		err := writeCgroup(cg.parent, "cgroup.subtree_control", "-"+c)
+		if err != nil {
+			log.Println(err)
+		}
+	}
+	err := writeCgroup(cg.parent, "cgroup.procs", strconv.Itoa(os.Getpid()))
+	if err != nil {
+		// Other controllers are still enabled in the parent, so this
+		// process has to stay in benchmark.main.
+		log.Println("cannot leave benchmark.main:", err)
+		return
+	}
+	err = os.Remove(cg.leaf)
+	if err != nil && !os.IsNotExist(err) {
+		log.Println("cannot remove cgroup:", err)
+	}
+}
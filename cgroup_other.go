@@ -0,0 +1,21 @@
+//go:build !linux
+
+package main
+
+import (
+	"errors"
+	"os/exec"
+)
+
+// cgroup is a cgroup v2 the timed builds run in; there are none outside Linux.
+type cgroup struct{}
+
+func newCgroup(l *Limits) (*cgroup, error) {
+	return nil, errors.New("cgroup limits are only supported on Linux")
+}
+
+func (c *cgroup) enter(cmd *exec.Cmd) {}
+
+func (c *cgroup) kill() {}
+
+func (c *cgroup) remove() {}
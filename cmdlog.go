@@ -0,0 +1,200 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"sync"
+
+	"github.com/spf13/pflag"
+)
+
+var (
+	quiet  bool
+	logDir string
+)
+
+func init() {
+	pflag.BoolVarP(&quiet, "quiet", "q", false, "only print progress; cmake and ninja output other than ninja's [n/N] lines goes to the log files only")
+	pflag.StringVar(&logDir, "log-dir", "", "directory to keep the output of cmake and ninja in (default <work-dir>/logs)")
+}
+
+// failureTail is how many of the last lines of output a failed command's
+// summary shows.
+const failureTail = 30
+
+// commandLogs keeps the output of the commands of one run in one file per
+// phase, in a directory outside the build directory so that it survives the
+// cleanup.
+type commandLogs struct {
+	dir string
+
+	mu    sync.Mutex
+	files map[string]*os.File
+}
+
+// newCommandLogs creates the log directory of the run in buildDir.
+func newCommandLogs(buildDir string) (*commandLogs, error) {
+	dir := logDir
+	if dir == "" {
+		dir = filepath.Join(workDir, "logs")
+	}
+	dir = filepath.Join(dir, filepath.Base(buildDir))
+	err := os.MkdirAll(dir, 0755)
+	if err != nil {
+		return nil, err
+	}
+	return &commandLogs{dir: dir, files: map[string]*os.File{}}, nil
+}
+
+func (l *commandLogs) file(phase string) (*os.File, error) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if f, ok := l.files[phase]; ok {
+		return f, nil
+	}
+	f, err := os.OpenFile(filepath.Join(l.dir, phase+".log"), os.O_WRONLY|os.O_CREATE|os.O_APPEND, 0644)
+	if err != nil {
+		return nil, err
+	}
+	l.files[phase] = f
+	return f, nil
+}
+
+func (l *commandLogs) close() {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	for _, f := range l.files {
+		f.Close()
+	}
+}
+
+// run runs cmd with its output also going to the log of phase, or only
+// there with --quiet. If cmd fails, the end of its output and the first
+// error in it are printed.
+func (l *commandLogs) run(cmd *exec.Cmd, phase string) error {
+	f, err := l.file(phase)
+	if err != nil {
+		log.Println("cannot open log file:", err)
+		return runCmd(cmd)
+	}
+	fmt.Fprintln(f, "running:", cmd)
+	offset, err := f.Seek(0, io.SeekEnd)
+	if err != nil {
+		return err
+	}
+
+	// Stdout and Stderr share one writer, which exec then never calls from
+	// two goroutines at once.
+	var out io.Writer = io.MultiWriter(os.Stdout, f)
+	var progress *progressWriter
+	if quiet {
+		progress = &progressWriter{console: os.Stdout, log: f}
+		out = progress
+	}
+	if cmd.Stdout == os.Stdout {
+		cmd.Stdout = out
+	}
+	cmd.Stderr = out
+
+	err = runCmd(cmd)
+	if progress != nil {
+		progress.flush()
+	}
+	if err != nil {
+		printFailure(f.Name(), offset)
+		fmt.Fprintln(f, "command failed:", err)
+	}
+	return err
+}
+
+// progressLine matches ninja's progress lines, "[12/345] Building ...".
+var progressLine = regexp.MustCompile(`^\[\d+/\d+\] `)
+
+// progressWriter splits the output of a command into lines for --quiet: the
+// progress lines go to the console and all others to the log.
+type progressWriter struct {
+	console, log io.Writer
+	partial      []byte
+}
+
+func (w *progressWriter) Write(p []byte) (int, error) {
+	w.partial = append(w.partial, p...)
+	for {
+		i := bytes.IndexByte(w.partial, '\n')
+		if i < 0 {
+			return len(p), nil
+		}
+		w.writeLine(w.partial[:i+1])
+		w.partial = w.partial[i+1:]
+	}
+}
+
+func (w *progressWriter) writeLine(line []byte) {
+	if progressLine.Match(line) {
+		w.console.Write(line)
+	} else {
+		w.log.Write(line)
+	}
+}
+
+// flush writes out a last line that did not end in a newline.
+func (w *progressWriter) flush() {
+	if len(w.partial) > 0 {
+		w.writeLine(append(w.partial, '\n'))
+		w.partial = nil
+	}
+}
+
+// printFailure prints the summary of a failed command whose output starts
+// at offset in the log file path.
+func printFailure(path string, offset int64) {
+	f, err := os.Open(path)
+	if err != nil {
+		return
+	}
+	defer f.Close()
+	_, err = f.Seek(offset, io.SeekStart)
+	if err != nil {
+		return
+	}
+	output, err := io.ReadAll(f)
+	if err != nil {
+		return
+	}
+
+	tail, first := failureSummary(string(output), failureTail)
+	log.Printf("last %d lines of output, from %s:", len(tail), path)
+	for _, line := range tail {
+		fmt.Fprintln(os.Stderr, "  "+line)
+	}
+	if first != "" {
+		log.Println("first error:", first)
+	}
+}
+
+// compilerError matches the diagnostics of clang ("file:12:5: error: ..."),
+// lld ("ld.lld: error: ...") and cmake ("CMake Error at ...").
+var compilerError = regexp.MustCompile(`(^|: )(fatal )?error: |^CMake Error`)
+
+// failureSummary returns the last n lines of output and its first error
+// message, if any.
+func failureSummary(output string, n int) (tail []string, first string) {
+	lines := strings.Split(strings.TrimRight(output, "\n"), "\n")
+	for _, line := range lines {
+		if compilerError.MatchString(line) {
+			first = line
+			break
+		}
+	}
+	if len(lines) > n {
+		lines = lines[len(lines)-n:]
+	}
+	return lines, first
+}
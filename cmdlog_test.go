@@ -0,0 +1,53 @@
+package main
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestFailureSummary(t *testing.T) {
+	const output = `[1/3] Building CXX object lib/a.o
+FAILED: lib/b.o
+../llvm/lib/b.cpp:12:5: error: use of undeclared identifier 'x'
+../llvm/lib/b.cpp:20:1: error: expected ';'
+2 errors generated.
+ninja: build stopped: subcommand failed.
+`
+	tail, first := failureSummary(output, 2)
+	if first != "../llvm/lib/b.cpp:12:5: error: use of undeclared identifier 'x'" {
+		t.Errorf("first error: got %q", first)
+	}
+	want := []string{"2 errors generated.", "ninja: build stopped: subcommand failed."}
+	if !reflect.DeepEqual(tail, want) {
+		t.Errorf("tail: got %q, want %q", tail, want)
+	}
+
+	_, first = failureSummary("ld.lld: error: undefined symbol: foo\n", 10)
+	if first != "ld.lld: error: undefined symbol: foo" {
+		t.Errorf("lld error: got %q", first)
+	}
+	_, first = failureSummary("CMake Error at CMakeLists.txt:3 (message):\n", 10)
+	if first != "CMake Error at CMakeLists.txt:3 (message):" {
+		t.Errorf("cmake error: got %q", first)
+	}
+	_, first = failureSummary("warning: unused variable 'error'\n", 10)
+	if first != "" {
+		t.Errorf("got error %q from a warning", first)
+	}
+}
+
+func TestProgressWriter(t *testing.T) {
+	var console, log strings.Builder
+	w := &progressWriter{console: &console, log: &log}
+	w.Write([]byte("[1/2] Building CXX object a.o\nwarn"))
+	w.Write([]byte("ing: unused\n[2/2] Linking bin/llc\nlast"))
+	w.flush()
+
+	if want := "[1/2] Building CXX object a.o\n[2/2] Linking bin/llc\n"; console.String() != want {
+		t.Errorf("console: got %q, want %q", console.String(), want)
+	}
+	if want := "warning: unused\nlast\n"; log.String() != want {
+		t.Errorf("log: got %q, want %q", log.String(), want)
+	}
+}
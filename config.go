@@ -48,6 +48,22 @@ func (c *Config) Packages() []Package {
 	return pkgs
 }
 
+// withSource returns c, or if patterns is not empty a copy of c whose LLVM
+// source archive also extracts the paths matching patterns.
+func (c *Config) withSource(patterns []string) *Config {
+	if len(patterns) == 0 || c.LLVMSrcArchive.Keep == nil {
+		return c
+	}
+	src := *c.LLVMSrcArchive
+	keep, extra := src.Keep, keepPaths(patterns...)
+	src.Keep = func(p string) bool {
+		return keep(p) || extra(p)
+	}
+	cc := *c
+	cc.LLVMSrcArchive = &src
+	return &cc
+}
+
 // llvm-tblgen path relative to buildDir
 func (c *Config) LLVMTblgen() string {
 	return exe(filepath.Join(c.ClangBin, "llvm-tblgen"))
@@ -2,8 +2,6 @@ package main
 
 import "strings"
 
-const downloadDir = "dl"
-
 // keepPaths builds an Archive.Keep filter. A pattern ending in "/" keeps that
 // directory and everything under it; any other pattern keeps an exact path.
 func keepPaths(patterns ...string) func(string) bool {
@@ -23,20 +21,22 @@ func keepPaths(patterns ...string) func(string) bool {
 
 // The build runs only a few of the toolchain's (statically linked) tools, so we
 // extract just those plus clang's resource headers instead of the full ~12 GB.
+// clang-tblgen is only run by the clang track.
 var toolchainKeep = keepPaths(
 	// unix names (clang++ -> clang -> clang-22 and ld.lld -> lld are symlinks)
 	"bin/clang", "bin/clang++", "bin/clang-22",
 	"bin/lld", "bin/ld.lld",
-	"bin/llvm-tblgen", "bin/llvm-ar", "bin/llvm-ranlib",
+	"bin/llvm-tblgen", "bin/clang-tblgen", "bin/llvm-ar", "bin/llvm-ranlib",
 	// windows names (separate .exe copies; no clang-22)
 	"bin/clang.exe", "bin/clang++.exe",
 	"bin/lld.exe", "bin/ld.lld.exe",
-	"bin/llvm-tblgen.exe", "bin/llvm-ar.exe", "bin/llvm-ranlib.exe",
+	"bin/llvm-tblgen.exe", "bin/clang-tblgen.exe", "bin/llvm-ar.exe", "bin/llvm-ranlib.exe",
 	"lib/clang/",
 )
 
 // Building llc needs only the llvm project and the shared cmake / third-party
-// modules it references; the monorepo's other projects are skipped.
+// modules it references; the monorepo's other projects are skipped unless a
+// track asks for them (see Track.Source).
 var llvmSrcKeep = keepPaths("llvm/", "cmake/", "third-party/")
 
 const (
@@ -0,0 +1,58 @@
+package main
+
+import "fmt"
+
+// lowUtilization is the CPU utilization below which a build is considered to
+// leave cores idle, e.g. while waiting on a long serial link.
+const lowUtilization = 0.5
+
+// CPUTimeline is how busy the CPUs were over the course of a build.
+type CPUTimeline struct {
+	// Interval is the time between points in seconds.
+	Interval float64    `json:"interval"`
+	Points   []CPUPoint `json:"points"`
+
+	// AvgUtil is the mean utilization over the build of the CPUs it may run
+	// on, from 0 to 1, and LowUtilShare the share of the build's time during which it was
+	// below lowUtilization.
+	AvgUtil      float64 `json:"avg_util"`
+	LowUtilShare float64 `json:"low_util_share"`
+}
+
+// CPUPoint is the CPU utilization in the interval before T, in seconds since
+// the start of the build.
+type CPUPoint struct {
+	T float64 `json:"t"`
+	// Util is the utilization of the CPUs the build may run on together,
+	// as restricted by --cpus, --core-type and --cgroup-cpuset, and CPUs
+	// that of each online CPU, from 0 to 1.
+	Util float64   `json:"util"`
+	CPUs []float64 `json:"cpus"`
+	// Load1 is the 1-minute load average at T.
+	Load1 float64 `json:"load1"`
+}
+
+// summarize fills in AvgUtil and LowUtilShare from the points, weighting
+// each by the length of its interval.
+func (tl *CPUTimeline) summarize() {
+	var sum, low, prev float64
+	for _, p := range tl.Points {
+		dt := p.T - prev
+		prev = p.T
+		sum += p.Util * dt
+		if p.Util < lowUtilization {
+			low += dt
+		}
+	}
+	if prev == 0 {
+		return
+	}
+	tl.AvgUtil = sum / prev
+	tl.LowUtilShare = low / prev
+}
+
+func printCPUTimeline(tl *CPUTimeline) {
+	fmt.Println("cpu utilization:")
+	fmt.Printf("  average:        %.0f%%\n", 100*tl.AvgUtil)
+	fmt.Printf("  time below %.0f%%: %.0f%%\n", 100*lowUtilization, 100*tl.LowUtilShare)
+}
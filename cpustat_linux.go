@@ -0,0 +1,173 @@
+package main
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// cpuTimes is one line of /proc/stat, in clock ticks.
+type cpuTimes struct {
+	idle  uint64 // idle + iowait
+	total uint64
+}
+
+// utilization returns the share of time the CPU was busy between prev and c.
+func (c cpuTimes) utilization(prev cpuTimes) float64 {
+	total := c.total - prev.total
+	if total == 0 {
+		return 0
+	}
+	return 1 - float64(c.idle-prev.idle)/float64(total)
+}
+
+// procStat is the CPU part of /proc/stat: the aggregate line followed by one
+// line per online CPU.
+type procStat struct {
+	all    cpuTimes
+	cpus   []cpuTimes
+	ids    []int  // CPU number of each entry in cpus
+	iowait uint64 // aggregate iowait ticks
+}
+
+// parseProcStat parses the "cpu" lines of /proc/stat. Their fields are user,
+// nice, system, idle, iowait, irq, softirq, steal, guest and guest_nice;
+// guest time is already included in user and nice, so it is not added again.
+func parseProcStat(r io.Reader) (*procStat, error) {
+	st := &procStat{}
+	s := bufio.NewScanner(r)
+	for s.Scan() {
+		fields := strings.Fields(s.Text())
+		if len(fields) < 5 || !strings.HasPrefix(fields[0], "cpu") {
+			continue
+		}
+		var v []uint64
+		for _, f := range fields[1:] {
+			n, err := strconv.ParseUint(f, 10, 64)
+			if err != nil {
+				return nil, fmt.Errorf("bad /proc/stat line: %q", s.Text())
+			}
+			v = append(v, n)
+		}
+		var t cpuTimes
+		for i, n := range v {
+			if i < 8 {
+				t.total += n
+			}
+		}
+		t.idle = v[3]
+		if len(v) > 4 {
+			t.idle += v[4]
+		}
+
+		if fields[0] == "cpu" {
+			st.all = t
+			if len(v) > 4 {
+				st.iowait = v[4]
+			}
+		} else {
+			id, err := strconv.Atoi(fields[0][len("cpu"):])
+			if err != nil {
+				return nil, fmt.Errorf("bad /proc/stat line: %q", s.Text())
+			}
+			st.cpus = append(st.cpus, t)
+			st.ids = append(st.ids, id)
+		}
+	}
+	if s.Err() != nil {
+		return nil, s.Err()
+	}
+	if st.all.total == 0 {
+		return nil, fmt.Errorf("no cpu line in /proc/stat")
+	}
+	return st, nil
+}
+
+// sum adds up the times of cpus, or returns the aggregate if cpus is nil.
+func (st *procStat) sum(cpus []int) cpuTimes {
+	if cpus == nil {
+		return st.all
+	}
+	var t cpuTimes
+	for i, id := range st.ids {
+		if slices.Contains(cpus, id) {
+			t.idle += st.cpus[i].idle
+			t.total += st.cpus[i].total
+		}
+	}
+	return t
+}
+
+func readProcStat() (*procStat, error) {
+	f, err := os.Open("/proc/stat")
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	return parseProcStat(f)
+}
+
+// readLoad1 returns the 1-minute load average from /proc/loadavg.
+func readLoad1() (float64, error) {
+	b, err := os.ReadFile("/proc/loadavg")
+	if err != nil {
+		return 0, err
+	}
+	fields := strings.Fields(string(b))
+	if len(fields) == 0 {
+		return 0, fmt.Errorf("empty /proc/loadavg")
+	}
+	return strconv.ParseFloat(fields[0], 64)
+}
+
+// cpuMonitor samples /proc/stat and /proc/loadavg.
+type cpuMonitor struct {
+	cpus []int // the CPUs the build may run on, or nil for all
+	prev *procStat
+	tl   *CPUTimeline
+}
+
+// newCPUMonitor returns a monitor of the utilization of cpus, or of all CPUs
+// if cpus is nil.
+func newCPUMonitor(cpus []int) monitor {
+	st, err := readProcStat()
+	if err != nil {
+		log.Println("not monitoring cpu utilization:", err)
+		return nil
+	}
+	return &cpuMonitor{
+		cpus: cpus,
+		prev: st,
+		tl:   &CPUTimeline{Interval: sampleInterval.Seconds()},
+	}
+}
+
+func (m *cpuMonitor) sample(t time.Duration) {
+	st, err := readProcStat()
+	if err != nil || st.all.total == m.prev.all.total {
+		return
+	}
+	p := CPUPoint{
+		T:    t.Seconds(),
+		Util: st.sum(m.cpus).utilization(m.prev.sum(m.cpus)),
+	}
+	for i, c := range st.cpus {
+		if i < len(m.prev.cpus) {
+			p.CPUs = append(p.CPUs, c.utilization(m.prev.cpus[i]))
+		}
+	}
+	p.Load1, _ = readLoad1()
+	m.tl.Points = append(m.tl.Points, p)
+	m.prev = st
+}
+
+func (m *cpuMonitor) finish(s *Sample) {
+	m.tl.summarize()
+	s.CPU = m.tl
+}
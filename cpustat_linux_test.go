@@ -0,0 +1,37 @@
+package main
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestParseProcStat(t *testing.T) {
+	const stat = `cpu  100 0 100 700 100 0 0 0 50 0
+cpu0 50 0 50 300 100 0 0 0 25 0
+cpu1 50 0 50 400 0 0 0 0 25 0
+intr 12345 0 0
+ctxt 67890
+`
+	st, err := parseProcStat(strings.NewReader(stat))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if st.all.total != 1000 || st.all.idle != 800 || st.iowait != 100 {
+		t.Errorf("aggregate: got %+v iowait %d", st.all, st.iowait)
+	}
+	if len(st.cpus) != 2 || st.cpus[1].idle != 400 || st.ids[1] != 1 {
+		t.Errorf("per cpu: got %+v", st.cpus)
+	}
+
+	if got := st.sum([]int{1}); got != st.cpus[1] {
+		t.Errorf("sum of cpu 1: got %+v", got)
+	}
+	if got := st.sum(nil); got != st.all {
+		t.Errorf("sum of all: got %+v", got)
+	}
+
+	later := cpuTimes{idle: 900, total: 1400}
+	if got := later.utilization(st.all); got != 0.75 {
+		t.Errorf("utilization: got %v, want 0.75", got)
+	}
+}
@@ -0,0 +1,15 @@
+package main
+
+import "testing"
+
+func TestCPUTimelineSummarize(t *testing.T) {
+	tl := &CPUTimeline{Points: []CPUPoint{
+		{T: 1, Util: 1},
+		{T: 2, Util: 0.2},
+		{T: 4, Util: 0.9},
+	}}
+	tl.summarize()
+	if tl.AvgUtil != 0.75 || tl.LowUtilShare != 0.25 {
+		t.Errorf("got avg %v low %v, want 0.75 0.25", tl.AvgUtil, tl.LowUtilShare)
+	}
+}
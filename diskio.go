@@ -0,0 +1,41 @@
+package main
+
+import "fmt"
+
+// DiskIO is the disk activity during one phase of the benchmark.
+type DiskIO struct {
+	// Device is the block device that backs the build directory, as named in
+	// /proc/diskstats, or empty if it has none (tmpfs, network filesystems,
+	// ...). The Device fields below are only set if it is known.
+	Device string `json:"device,omitempty"`
+	// ReadBytes and WriteBytes are the bytes transferred to the device, and
+	// IOPS the completed requests per second.
+	ReadBytes  int64   `json:"read_bytes,omitempty"`
+	WriteBytes int64   `json:"write_bytes,omitempty"`
+	IOPS       float64 `json:"iops,omitempty"`
+	// Busy is the share of the time the device had requests in flight.
+	Busy float64 `json:"busy,omitempty"`
+	// PeakReadRate and PeakWriteRate are the highest rates over one sample
+	// interval, in bytes per second.
+	PeakReadRate  float64 `json:"peak_read_rate,omitempty"`
+	PeakWriteRate float64 `json:"peak_write_rate,omitempty"`
+
+	// ProcReadBytes and ProcWriteBytes are what this process and the
+	// children it has waited for caused to be read from and written to
+	// storage, from /proc/self/io.
+	ProcReadBytes  int64 `json:"proc_read_bytes"`
+	ProcWriteBytes int64 `json:"proc_write_bytes"`
+	// IOWait is the share of CPU time spent idle waiting for I/O.
+	IOWait float64 `json:"iowait"`
+}
+
+func printDiskIO(label string, d *DiskIO) {
+	fmt.Printf("%s: read %.0f MB, wrote %.0f MB, iowait %.1f%%", label,
+		float64(d.ProcReadBytes)/1e6, float64(d.ProcWriteBytes)/1e6, 100*d.IOWait)
+	if d.Device != "" {
+		fmt.Printf("; %s: read %.0f MB, wrote %.0f MB, %.0f IOPS, %.0f%% busy, peak %.0f/%.0f MB/s read/write",
+			d.Device, float64(d.ReadBytes)/1e6, float64(d.WriteBytes)/1e6, d.IOPS, 100*d.Busy,
+			d.PeakReadRate/1e6, d.PeakWriteRate/1e6)
+	}
+	fmt.Println()
+}
@@ -0,0 +1,172 @@
+package main
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"strconv"
+	"strings"
+	"syscall"
+	"time"
+
+	"golang.org/x/sys/unix"
+)
+
+// diskstatsSector is the unit of the sector counts in /proc/diskstats,
+// regardless of the device's real sector size.
+const diskstatsSector = 512
+
+// diskStats is one line of /proc/diskstats.
+type diskStats struct {
+	reads, readSectors   int64
+	writes, writeSectors int64
+	ioTicks              int64 // milliseconds with I/O in flight
+}
+
+// parseDiskstats returns the counters of the device major:minor from
+// /proc/diskstats, and the device's name.
+func parseDiskstats(r io.Reader, major, minor uint32) (string, diskStats, error) {
+	s := bufio.NewScanner(r)
+	for s.Scan() {
+		f := strings.Fields(s.Text())
+		if len(f) < 13 || f[0] != strconv.Itoa(int(major)) || f[1] != strconv.Itoa(int(minor)) {
+			continue
+		}
+		var v [10]int64
+		for i := range v {
+			n, err := strconv.ParseInt(f[3+i], 10, 64)
+			if err != nil {
+				return "", diskStats{}, fmt.Errorf("bad /proc/diskstats line: %q", s.Text())
+			}
+			v[i] = n
+		}
+		return f[2], diskStats{
+			reads:        v[0],
+			readSectors:  v[2],
+			writes:       v[4],
+			writeSectors: v[6],
+			ioTicks:      v[9],
+		}, nil
+	}
+	if s.Err() != nil {
+		return "", diskStats{}, s.Err()
+	}
+	return "", diskStats{}, fmt.Errorf("device %d:%d not in /proc/diskstats", major, minor)
+}
+
+// parseProcIO returns read_bytes and write_bytes from /proc/<pid>/io.
+func parseProcIO(r io.Reader) (read, write int64, err error) {
+	s := bufio.NewScanner(r)
+	for s.Scan() {
+		key, value, ok := strings.Cut(s.Text(), ":")
+		if !ok {
+			continue
+		}
+		n, err := strconv.ParseInt(strings.TrimSpace(value), 10, 64)
+		if err != nil {
+			return 0, 0, fmt.Errorf("bad /proc/self/io line: %q", s.Text())
+		}
+		switch key {
+		case "read_bytes":
+			read = n
+		case "write_bytes":
+			write = n
+		}
+	}
+	return read, write, s.Err()
+}
+
+// diskCounters is a snapshot of every counter a diskMonitor reads.
+type diskCounters struct {
+	t         time.Time
+	disk      diskStats
+	procRead  int64
+	procWrite int64
+	cpuIOWait uint64
+	cpuTotal  uint64
+	diskErr   error
+}
+
+// diskMonitor measures disk I/O on the device backing a directory.
+type diskMonitor struct {
+	major, minor uint32
+	device       string
+	first, prev  diskCounters
+	io           *DiskIO
+}
+
+func (m *diskMonitor) read() diskCounters {
+	c := diskCounters{t: time.Now()}
+
+	f, err := os.Open("/proc/diskstats")
+	if err == nil {
+		m.device, c.disk, c.diskErr = parseDiskstats(f, m.major, m.minor)
+		f.Close()
+	} else {
+		c.diskErr = err
+	}
+
+	f, err = os.Open("/proc/self/io")
+	if err == nil {
+		c.procRead, c.procWrite, _ = parseProcIO(f)
+		f.Close()
+	}
+
+	if st, err := readProcStat(); err == nil {
+		c.cpuIOWait = st.iowait
+		c.cpuTotal = st.all.total
+	}
+	return c
+}
+
+// newDiskMonitor returns a monitor of the disk I/O to the device backing dir.
+func newDiskMonitor(dir string) monitor {
+	var st syscall.Stat_t
+	err := syscall.Stat(dir, &st)
+	if err != nil {
+		log.Println("not monitoring disk I/O:", err)
+		return nil
+	}
+	m := &diskMonitor{
+		major: unix.Major(uint64(st.Dev)),
+		minor: unix.Minor(uint64(st.Dev)),
+		io:    &DiskIO{},
+	}
+	m.first = m.read()
+	m.prev = m.first
+	return m
+}
+
+func (m *diskMonitor) sample(t time.Duration) {
+	c := m.read()
+	dt := c.t.Sub(m.prev.t).Seconds()
+	if c.diskErr == nil && m.prev.diskErr == nil && dt > 0 {
+		read := float64(c.disk.readSectors-m.prev.disk.readSectors) * diskstatsSector / dt
+		write := float64(c.disk.writeSectors-m.prev.disk.writeSectors) * diskstatsSector / dt
+		m.io.PeakReadRate = max(m.io.PeakReadRate, read)
+		m.io.PeakWriteRate = max(m.io.PeakWriteRate, write)
+	}
+	m.prev = c
+}
+
+func (m *diskMonitor) finish(s *Sample) {
+	a, b := m.first, m.read()
+	d := m.io
+	d.ProcReadBytes = b.procRead - a.procRead
+	d.ProcWriteBytes = b.procWrite - a.procWrite
+	if b.cpuTotal > a.cpuTotal {
+		d.IOWait = float64(b.cpuIOWait-a.cpuIOWait) / float64(b.cpuTotal-a.cpuTotal)
+	}
+
+	dt := b.t.Sub(a.t).Seconds()
+	if a.diskErr == nil && b.diskErr == nil && dt > 0 {
+		d.Device = m.device
+		d.ReadBytes = (b.disk.readSectors - a.disk.readSectors) * diskstatsSector
+		d.WriteBytes = (b.disk.writeSectors - a.disk.writeSectors) * diskstatsSector
+		d.IOPS = float64(b.disk.reads-a.disk.reads+b.disk.writes-a.disk.writes) / dt
+		d.Busy = float64(b.disk.ioTicks-a.disk.ioTicks) / 1000 / dt
+	}
+	s.Disk = d
+}
@@ -0,0 +1,43 @@
+package main
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestParseDiskstats(t *testing.T) {
+	const diskstats = ` 259       0 nvme0n1 1000 10 80000 500 2000 20 160000 900 0 1200 1400 0 0 0 0
+ 259       1 nvme0n1p1 100 0 800 50 10 0 80 9 0 40 59 0 0 0 0
+`
+	name, st, err := parseDiskstats(strings.NewReader(diskstats), 259, 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := diskStats{reads: 100, readSectors: 800, writes: 10, writeSectors: 80, ioTicks: 40}
+	if name != "nvme0n1p1" || st != want {
+		t.Errorf("got %s %+v, want nvme0n1p1 %+v", name, st, want)
+	}
+
+	_, _, err = parseDiskstats(strings.NewReader(diskstats), 0, 42)
+	if err == nil {
+		t.Error("expected an error for a device that is not listed")
+	}
+}
+
+func TestParseProcIO(t *testing.T) {
+	const procIO = `rchar: 323934931
+wchar: 323929600
+syscr: 632687
+syscw: 632675
+read_bytes: 4096
+write_bytes: 8192
+cancelled_write_bytes: 0
+`
+	read, write, err := parseProcIO(strings.NewReader(procIO))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if read != 4096 || write != 8192 {
+		t.Errorf("got %d %d, want 4096 8192", read, write)
+	}
+}
@@ -0,0 +1,8 @@
+//go:build !linux
+
+package main
+
+// newDiskMonitor returns nil: disk I/O is only read from Linux's /proc.
+func newDiskMonitor(dir string) monitor {
+	return nil
+}
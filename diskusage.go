@@ -0,0 +1,65 @@
+package main
+
+import (
+	"io/fs"
+	"path/filepath"
+	"time"
+
+	"github.com/afq984/BenchmarkV3/systemdetect"
+)
+
+// diskUsageMonitor tracks the size of the cmake output directory during a
+// build.
+// Walking the tree every interval would disturb the build, so it watches the
+// free space of the filesystem instead, and measures the tree only once, at
+// the end.
+type diskUsageMonitor struct {
+	dir   string
+	free0 int64
+	peak  int64 // largest drop in free space
+	last  int64 // latest drop in free space
+}
+
+func newDiskUsageMonitor(dir string) monitor {
+	free, err := systemdetect.DiskFree(dir)
+	if err != nil {
+		return nil
+	}
+	return &diskUsageMonitor{dir: dir, free0: free}
+}
+
+func (m *diskUsageMonitor) sample(t time.Duration) {
+	free, err := systemdetect.DiskFree(m.dir)
+	if err != nil {
+		return
+	}
+	m.last = m.free0 - free
+	m.peak = max(m.peak, m.last)
+}
+
+func (m *diskUsageMonitor) finish(s *Sample) {
+	size, err := dirSize(m.dir)
+	if err != nil {
+		return
+	}
+	s.PeakDirSize = size + m.peak - m.last
+}
+
+// dirSize returns the total size of the regular files under dir.
+func dirSize(dir string) (int64, error) {
+	var size int64
+	err := filepath.WalkDir(dir, func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if d.Type().IsRegular() {
+			info, err := d.Info()
+			if err != nil {
+				return err
+			}
+			size += info.Size()
+		}
+		return nil
+	})
+	return size, err
+}
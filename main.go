@@ -1,9 +1,11 @@
 package main
 
 import (
+	"errors"
 	"fmt"
 	"log"
 	"os"
+	"sort"
 	"time"
 
 	"github.com/spf13/pflag"
@@ -16,18 +18,20 @@ func main() {
 		config       string
 		detect       bool
 		outputURL    string
+		outputJSON   string
 		downloadOnly bool
 	)
 	pflag.StringVarP(&config, "config", "c", "auto", "config to use")
 	pflag.BoolVar(&detect, "detect", false, "detect the system only; don't run any benchmarks")
 	pflag.StringVar(&outputURL, "output-url", "", "write submission URL to file")
+	pflag.StringVar(&outputJSON, "output-json", "", "write the full result, including every sample, as JSON to file")
 	pflag.BoolVar(&downloadOnly, "download-only", false, "only download the files; don't run any benchmarks")
 	pflag.Parse()
 
 	if downloadOnly {
 		downloadMain(config)
 	} else {
-		benchmarkMain(detect, config, outputURL)
+		benchmarkMain(detect, config, outputURL, outputJSON)
 	}
 }
 
@@ -50,40 +54,53 @@ func downloadMain(config string) {
 	DownloadOnly(cfg)
 }
 
-func benchmarkMain(detect bool, config string, outputURL string) {
-	var (
-		track string
-		dt    time.Duration
-		err   error
-		cfg   *Config
-	)
+func benchmarkMain(detect bool, config string, outputURL string, outputJSON string) {
+	r := &Result{}
 
 	if detect {
-		dt = 99 * time.Second
-		config = "detect"
-		track = "detect"
+		r.Time = 99
+		r.Config = "detect"
+		r.Track = "detect"
 	} else {
-		if quick {
-			track = "quick"
-		} else {
-			track = "standard"
+		if runs < 1 {
+			log.Fatalf("--runs must be at least 1, got %d", runs)
 		}
+		var err error
+		sweepJobList, err = sortJobs(sweepJobList)
+		if err != nil {
+			log.Fatal(err)
+		}
+		var (
+			cfg *Config
+			t   *Track
+		)
+		r.Track, t = getTrack()
+		r.Config, cfg = getConfig(config)
+		err = Build(cfg, t, r)
 
-		config, cfg = getConfig(config)
-		dt, err = Build(cfg)
-
+		if errors.Is(err, errInterrupted) {
+			log.Println("interrupted")
+			os.Exit(130)
+		}
 		if err != nil {
 			log.Println("benchmark failed")
 			os.Exit(1)
 		}
 	}
 
-	r := &Result{
-		Track:  track,
-		Config: config,
-		Time:   float64(dt) / float64(time.Second),
-	}
 	populateSystem(r)
+	if r.Limits != nil {
+		r.Misc += " [" + r.Limits.String() + "]"
+	}
+	if r.Affinity != "" {
+		r.Misc += " [" + affinityString(r) + "]"
+	}
+	if r.Throughput != nil {
+		r.Misc += fmt.Sprintf(" [throughput %d]", r.Throughput.Builds)
+	}
+	if len(r.Sweep) > 0 {
+		r.Misc += fmt.Sprintf(" [sweep best -j%d]", fastest(r.Sweep).Jobs)
+	}
 
 	fmt.Println()
 	if detect {
@@ -93,13 +110,86 @@ func benchmarkMain(detect bool, config string, outputURL string) {
 		fmt.Printf("  cpu:      %s\n", r.CPU)
 		fmt.Printf("  memory:   %d bytes (%.1f GiB)\n", r.Memory, float64(r.Memory)/(1<<30))
 		fmt.Printf("  misc:     %s\n", r.Misc)
+		if thermal := detectThermal(); thermal != "" {
+			fmt.Printf("  thermal:  %s\n", thermal)
+		}
 		return
 	}
 
-	fmt.Println("build completed in", dt)
+	dt := seconds(r.Time)
+	if len(r.Sweep) == 0 {
+		printSamples(r.Samples)
+		printFinalSteps(r.Samples)
+	}
+	if len(r.Sweep) > 0 || r.Samples[0].Name != "" {
+		fmt.Println("submitted time:", dt)
+	}
+	if r.UnityRatio > 0 {
+		fmt.Printf("unity / normal build time: %.2f\n", r.UnityRatio)
+	}
 	fmt.Println("builds per hour:", float64(time.Hour)/float64(dt))
 	fmt.Println()
 
+	if len(r.Sweep) > 0 {
+		printSweep(r.Sweep)
+		fmt.Println()
+	}
+	if r.Throughput != nil {
+		printThroughput(r.Throughput)
+		fmt.Println()
+	}
+
+	if r.Limits != nil {
+		fmt.Println("timed builds limited to", r.Limits)
+	}
+	if r.Affinity != "" {
+		fmt.Println("cmake and ninja pinned to", affinityString(r))
+	}
+	fmt.Printf("work directory: %s (%s)\n", r.WorkDir, r.Filesystem)
+	if size := r.Samples[len(r.Samples)-1].PeakDirSize; size > 0 {
+		fmt.Printf("peak build directory size: %.1f GiB\n", float64(size)/(1<<30))
+	}
+	fmt.Println()
+
+	printPhases(r.Phases)
+	fmt.Println()
+
+	printRusage(r.Samples)
+
+	last := r.Samples[len(r.Samples)-1]
+	if r.Throughput != nil {
+		// The monitors watched the rounds, not the single builds.
+		last = r.Throughput.Rounds[len(r.Throughput.Rounds)-1]
+	}
+	if last.Profile != nil {
+		printProfile(last.Profile, last.Time)
+		fmt.Println()
+	}
+	if last.CPU != nil {
+		printCPUTimeline(last.CPU)
+		fmt.Println()
+	}
+	if last.Thermal != nil {
+		printThermalTimeline(last.Thermal)
+		fmt.Println()
+	}
+	if last.Disk != nil {
+		printDiskIO("build disk I/O", last.Disk)
+		fmt.Println()
+	}
+	if r.Pressure != nil {
+		printPressure(r.Pressure)
+		fmt.Println()
+	}
+
+	if outputJSON != "" {
+		err := writeResultJSON(outputJSON, r)
+		if err != nil {
+			log.Println("failed to write output json:", err)
+			os.Exit(1)
+		}
+	}
+
 	fmt.Println("Visit the following link to submit the results:")
 	fmt.Println(submissionURL(r))
 
@@ -111,3 +201,78 @@ func benchmarkMain(detect bool, config string, outputURL string) {
 		}
 	}
 }
+
+func printPhases(p *Phases) {
+	names := make([]string, 0, len(p.Packages))
+	for name := range p.Packages {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	fmt.Println("phase timings:")
+	if p.Reused {
+		fmt.Println("  setup and configure skipped: reused an existing build tree")
+	}
+	fmt.Printf("  setup:     %7.1fs\n", p.SetUp)
+	for _, name := range names {
+		t := p.Packages[name]
+		fmt.Printf("    %-60s download %6.1fs  check %5.1fs  extract %6.1fs", name, t.Download, t.Check, t.Extract)
+		if t.Extract > 0 && t.Size > 0 {
+			fmt.Printf(" (%.0f MB/s of archive)", float64(t.Size)/1e6/t.Extract)
+		}
+		fmt.Println()
+	}
+	if p.SetUpDisk != nil {
+		printDiskIO("    disk", p.SetUpDisk)
+	}
+	fmt.Printf("  toolchain: %7.1fs\n", p.Toolchain)
+	fmt.Printf("  configure: %7.1fs\n", p.Configure)
+	if len(p.ConfigureRuns) > 0 {
+		st := summarize(p.ConfigureRuns)
+		fmt.Printf("    %d fresh configures: min %.1fs  median %.1fs  stddev %.1fs\n",
+			len(p.ConfigureRuns), st.Min, st.Median, st.Stddev)
+	}
+	if p.NormalConfigure > 0 {
+		fmt.Printf("    non-unity tree to compare with: %.1fs\n", p.NormalConfigure)
+	}
+	if p.ThroughputConfigure > 0 {
+		fmt.Printf("    extra trees for throughput: %.1fs\n", p.ThroughputConfigure)
+	}
+	fmt.Printf("  build:     %7.1fs\n", p.Build)
+}
+
+// printSamples prints the time of each kind of build, in the order they ran,
+// summarizing repeated builds of the same kind.
+func printSamples(samples []*Sample) {
+	var names []string
+	times := map[string][]float64{}
+	for _, s := range samples {
+		if _, ok := times[s.Name]; !ok {
+			names = append(names, s.Name)
+		}
+		times[s.Name] = append(times[s.Name], s.Time)
+	}
+
+	for _, name := range names {
+		label := "build"
+		if name != "" {
+			label = name + " build"
+		}
+		ts := times[name]
+		st := summarize(ts)
+		if len(ts) == 1 {
+			fmt.Println(label, "completed in", seconds(st.Median))
+			continue
+		}
+		fmt.Printf("%d %ss completed; median %v\n", len(ts), label, seconds(st.Median))
+		fmt.Printf("  min:    %.2fs\n", st.Min)
+		fmt.Printf("  median: %.2fs\n", st.Median)
+		fmt.Printf("  mean:   %.2fs\n", st.Mean)
+		fmt.Printf("  stddev: %.2fs (%.1f%%)\n", st.Stddev, 100*st.Stddev/st.Mean)
+	}
+}
+
+// seconds converts a time in seconds, as stored in a Result, to a Duration.
+func seconds(s float64) time.Duration {
+	return time.Duration(s * float64(time.Second))
+}
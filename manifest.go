@@ -0,0 +1,59 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"reflect"
+)
+
+// manifestFileName is written into a configured build tree so that --reuse
+// can tell whether the tree matches the current config.
+const manifestFileName = "tree.json"
+
+// treeManifest describes how a build tree was set up.
+type treeManifest struct {
+	Packages  []string `json:"packages"`
+	CmakeArgs []string `json:"cmake_args"`
+}
+
+func (b *builder) manifest() *treeManifest {
+	m := &treeManifest{CmakeArgs: b.cmakeArgs(b.out)}
+	for _, p := range b.c.Packages() {
+		m.Packages = append(m.Packages, p.String())
+	}
+	return m
+}
+
+// writeManifest records in the tree how it was set up. It is written last, so
+// a tree whose setup failed or was interrupted has none.
+func (b *builder) writeManifest() error {
+	data, err := json.MarshalIndent(b.manifest(), "", "  ")
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(b.absPath(manifestFileName), append(data, '\n'), 0644)
+}
+
+// checkManifest returns an error unless the tree was completely set up and
+// configured for the same packages and cmake arguments as b would use.
+func (b *builder) checkManifest() error {
+	data, err := os.ReadFile(b.absPath(manifestFileName))
+	if err != nil {
+		return fmt.Errorf("%s is not a complete build tree: %w", b.dir, err)
+	}
+	var got treeManifest
+	err = json.Unmarshal(data, &got)
+	if err != nil {
+		return fmt.Errorf("bad %s: %w", manifestFileName, err)
+	}
+
+	want := b.manifest()
+	if !reflect.DeepEqual(got.Packages, want.Packages) {
+		return fmt.Errorf("%s was set up with packages %v, but the config uses %v", b.dir, got.Packages, want.Packages)
+	}
+	if !reflect.DeepEqual(got.CmakeArgs, want.CmakeArgs) {
+		return fmt.Errorf("%s was configured with %v, but this run would use %v", b.dir, got.CmakeArgs, want.CmakeArgs)
+	}
+	return nil
+}
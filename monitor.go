@@ -0,0 +1,78 @@
+package main
+
+import (
+	"sync"
+	"time"
+)
+
+// sampleInterval is how often the monitors observe the system during a timed
+// build.
+const sampleInterval = time.Second
+
+// A monitor observes the system while a timed build runs.
+type monitor interface {
+	// sample takes one observation, t after the build started.
+	sample(t time.Duration)
+	// finish stores what was observed in s.
+	finish(s *Sample)
+}
+
+// monitors returns the monitors for a timed build in b. Measuring the size of
+// the output directory walks all of it, so only tracks that need the disk
+// space for it, the debug build, do so.
+func monitors(b *builder) []monitor {
+	ms := platformMonitors(b)
+	if b.t.MinFree > 0 {
+		ms = append(ms, newDiskUsageMonitor(b.absPath(b.out)))
+	}
+	return ms
+}
+
+// watch calls sample on every monitor each interval from a background
+// goroutine, starting right away. The returned stop function takes a last
+// sample, waits for the goroutine to exit and then calls finish on every
+// monitor. nil monitors, which the constructors return for what this system
+// does not support, are skipped.
+func watch(monitors []monitor, interval time.Duration) (stop func(s *Sample)) {
+	var ms []monitor
+	for _, m := range monitors {
+		if m != nil {
+			ms = append(ms, m)
+		}
+	}
+
+	t0 := time.Now()
+	sampleAll := func() {
+		t := time.Since(t0)
+		for _, m := range ms {
+			m.sample(t)
+		}
+	}
+
+	done := make(chan struct{})
+	var wg sync.WaitGroup
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		sampleAll()
+		for {
+			select {
+			case <-ticker.C:
+				sampleAll()
+			case <-done:
+				return
+			}
+		}
+	}()
+
+	return func(s *Sample) {
+		close(done)
+		wg.Wait()
+		sampleAll()
+		for _, m := range ms {
+			m.finish(s)
+		}
+	}
+}
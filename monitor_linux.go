@@ -0,0 +1,12 @@
+package main
+
+// platformMonitors returns the monitors for a timed build in b. Those this
+// system does not support are nil.
+func platformMonitors(b *builder) []monitor {
+	return []monitor{
+		newCPUMonitor(buildCPUs()),
+		newThermalMonitor(),
+		newDiskMonitor(b.dir),
+		newPressureMonitor(),
+	}
+}
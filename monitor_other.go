@@ -0,0 +1,8 @@
+//go:build !linux
+
+package main
+
+// platformMonitors returns no monitors: they read Linux's /proc and /sys.
+func platformMonitors(b *builder) []monitor {
+	return nil
+}
@@ -0,0 +1,462 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"io"
+	"os"
+	"path"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// profileTop is how many of the slowest compile and link steps a
+// BuildProfile keeps.
+const profileTop = 5
+
+// BuildProfile summarizes where the time of one build went, from ninja's
+// .ninja_log and build graph.
+type BuildProfile struct {
+	// Steps is the number of build edges that ran.
+	Steps int `json:"steps"`
+	// CPUTime is the sum of the durations of all steps in seconds.
+	CPUTime float64 `json:"cpu_time"`
+	// CriticalPath is the length in seconds of the longest chain of steps
+	// that depend on each other. No number of cores can make the build
+	// faster than this.
+	CriticalPath float64 `json:"critical_path"`
+	// CriticalPathSteps is the number of steps on the critical path.
+	CriticalPathSteps int `json:"critical_path_steps"`
+	// LinkTime is the sum of the durations of all link steps in seconds.
+	LinkTime float64 `json:"link_time"`
+	// Final are the steps that produced the targets themselves, such as the
+	// link of bin/llc.
+	Final []StepTime `json:"final"`
+
+	SlowestCompiles []StepTime `json:"slowest_compiles"`
+	SlowestLinks    []StepTime `json:"slowest_links"`
+}
+
+// StepTime is the duration of one build step, named by its first output.
+type StepTime struct {
+	Output string  `json:"output"`
+	Time   float64 `json:"time"`
+}
+
+// ninjaStep is one edge recorded in .ninja_log. Times are in milliseconds
+// since the start of the ninja invocation that ran it.
+type ninjaStep struct {
+	start, end int64
+	outputs    []string
+}
+
+func (s *ninjaStep) duration() float64 {
+	return float64(s.end-s.start) / 1000
+}
+
+// parseNinjaLog reads .ninja_log entries (format v5 or v6). An edge with
+// several outputs has one line per output, all sharing the start and end
+// times and the command hash; those are merged into a single step.
+func parseNinjaLog(r io.Reader) ([]*ninjaStep, error) {
+	type key struct {
+		start, end int64
+		hash       string
+	}
+	byKey := map[key]*ninjaStep{}
+	var steps []*ninjaStep
+
+	s := bufio.NewScanner(r)
+	for s.Scan() {
+		line := s.Text()
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		fields := strings.Split(line, "\t")
+		if len(fields) != 5 {
+			return nil, fmt.Errorf("bad .ninja_log line: %q", line)
+		}
+		start, err := strconv.ParseInt(fields[0], 10, 64)
+		if err != nil {
+			return nil, fmt.Errorf("bad .ninja_log line: %q", line)
+		}
+		end, err := strconv.ParseInt(fields[1], 10, 64)
+		if err != nil {
+			return nil, fmt.Errorf("bad .ninja_log line: %q", line)
+		}
+
+		k := key{start, end, fields[4]}
+		step, ok := byKey[k]
+		if !ok {
+			step = &ninjaStep{start: start, end: end}
+			byKey[k] = step
+			steps = append(steps, step)
+		}
+		step.outputs = append(step.outputs, fields[3])
+	}
+	if s.Err() != nil {
+		return nil, s.Err()
+	}
+	return steps, nil
+}
+
+// parseNinjaGraph reads the graphviz output of `ninja -t graph` and returns
+// the direct inputs of every built file.
+//
+// ninja draws an edge with one input and one output as a single labelled
+// arrow from input to output; any other edge becomes an ellipse node with
+// arrows from its inputs and to its outputs. File nodes are labelled with
+// their path.
+func parseNinjaGraph(r io.Reader) (map[string][]string, error) {
+	files := map[string]string{}        // node id -> path
+	edgeInputs := map[string][]string{} // ellipse id -> input node ids
+	edgeOutputs := map[string][]string{}
+	var direct [][2]string // input node id, output node id
+
+	s := bufio.NewScanner(r)
+	for s.Scan() {
+		line := s.Text()
+		if !strings.HasPrefix(line, `"`) {
+			continue
+		}
+		id, rest, ok := strings.Cut(line[1:], `"`)
+		if !ok {
+			continue
+		}
+		rest = strings.TrimSpace(rest)
+
+		switch {
+		case strings.HasPrefix(rest, "->"):
+			to, attrs, ok := strings.Cut(strings.TrimSpace(rest[2:])[1:], `"`)
+			if !ok {
+				return nil, fmt.Errorf("bad ninja graph line: %q", line)
+			}
+			switch {
+			case strings.Contains(attrs, "arrowhead=none"):
+				edgeInputs[to] = append(edgeInputs[to], id)
+			case strings.Contains(attrs, "label="):
+				direct = append(direct, [2]string{id, to})
+			default:
+				edgeOutputs[id] = append(edgeOutputs[id], to)
+			}
+		case strings.HasPrefix(rest, "[label="):
+			if strings.Contains(rest, "shape=ellipse") {
+				continue
+			}
+			label, _, ok := strings.Cut(strings.TrimPrefix(rest, `[label="`), `"`)
+			if !ok {
+				return nil, fmt.Errorf("bad ninja graph line: %q", line)
+			}
+			files[id] = label
+		}
+	}
+	if s.Err() != nil {
+		return nil, s.Err()
+	}
+
+	inputs := map[string][]string{}
+	for _, d := range direct {
+		inputs[files[d[1]]] = append(inputs[files[d[1]]], files[d[0]])
+	}
+	for edge, outs := range edgeOutputs {
+		for _, out := range outs {
+			for _, in := range edgeInputs[edge] {
+				inputs[files[out]] = append(inputs[files[out]], files[in])
+			}
+		}
+	}
+	return inputs, nil
+}
+
+// parseNinjaQuery reads the output of `ninja -t query target` and returns the
+// rule of the edge that builds target and the edge's explicit inputs.
+//
+//	llc:
+//	  input: phony
+//	    bin/llc
+//	  outputs:
+func parseNinjaQuery(r io.Reader) (rule string, inputs []string, err error) {
+	inInputs := false
+	s := bufio.NewScanner(r)
+	for s.Scan() {
+		line := s.Text()
+		switch {
+		case strings.HasPrefix(line, "  input: "):
+			rule = strings.TrimPrefix(line, "  input: ")
+			inInputs = true
+		case strings.HasPrefix(line, "    "):
+			in := strings.TrimSpace(line)
+			// Implicit and order-only inputs are prefixed with | and ||.
+			if inInputs && !strings.HasPrefix(in, "|") {
+				inputs = append(inputs, in)
+			}
+		default:
+			inInputs = false
+		}
+	}
+	if s.Err() != nil {
+		return "", nil, s.Err()
+	}
+	if rule == "" {
+		return "", nil, fmt.Errorf("no input edge in ninja query output")
+	}
+	return rule, inputs, nil
+}
+
+// finalOutputs returns the files the final steps of targets produce, looking
+// through phony targets such as "llc" to the files they stand for, such as
+// "bin/llc".
+func (b *builder) finalOutputs(targets []string) ([]string, error) {
+	var outs []string
+	for _, target := range targets {
+		query, err := b.ninjaOutput("-t", "query", target)
+		if err != nil {
+			return nil, err
+		}
+		rule, inputs, err := parseNinjaQuery(bytes.NewReader(query))
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w", target, err)
+		}
+		if rule == "phony" {
+			outs = append(outs, inputs...)
+		} else {
+			outs = append(outs, target)
+		}
+	}
+	return outs, nil
+}
+
+// producers maps every output to the step that produced it.
+func producers(steps []*ninjaStep) map[string]*ninjaStep {
+	producer := map[string]*ninjaStep{}
+	for _, s := range steps {
+		for _, out := range s.outputs {
+			producer[out] = s
+		}
+	}
+	return producer
+}
+
+// finalSteps returns the steps that produced targets, looking through phony
+// targets such as "llc" to the files they stand for, such as "bin/llc".
+func finalSteps(steps []*ninjaStep, inputs map[string][]string, targets []string) []StepTime {
+	producer := producers(steps)
+	var final []StepTime
+	for _, target := range targets {
+		outs := []string{target}
+		if _, ok := producer[target]; !ok {
+			outs = inputs[target]
+		}
+		for _, out := range outs {
+			if s, ok := producer[out]; ok {
+				final = append(final, StepTime{Output: out, Time: s.duration()})
+			}
+		}
+	}
+	return final
+}
+
+// criticalPath returns the longest chain of dependent steps, measured by the
+// steps' durations, in the order they ran. inputs is the build graph from
+// parseNinjaGraph; files without a step (sources, or outputs that were already
+// up to date) end a chain.
+func criticalPath(steps []*ninjaStep, inputs map[string][]string) []*ninjaStep {
+	producer := producers(steps)
+
+	type result struct {
+		length float64
+		prev   *ninjaStep
+	}
+	memo := map[*ninjaStep]*result{}
+	var visit func(s *ninjaStep) *result
+	visit = func(s *ninjaStep) *result {
+		if r, ok := memo[s]; ok {
+			return r
+		}
+		// Guard against cycles in a malformed graph.
+		memo[s] = &result{length: s.duration()}
+		r := &result{length: s.duration()}
+		for _, out := range s.outputs {
+			for _, in := range inputs[out] {
+				p, ok := producer[in]
+				if !ok || p == s {
+					continue
+				}
+				if l := s.duration() + visit(p).length; l > r.length {
+					r.length = l
+					r.prev = p
+				}
+			}
+		}
+		memo[s] = r
+		return r
+	}
+
+	var last *ninjaStep
+	for _, s := range steps {
+		if last == nil || visit(s).length > visit(last).length {
+			last = s
+		}
+	}
+
+	var chain []*ninjaStep
+	for s := last; s != nil; s = memo[s].prev {
+		chain = append([]*ninjaStep{s}, chain...)
+	}
+	return chain
+}
+
+// stepKind classifies a step by its first output as a "compile", a "link" or
+// "other" (code generation, custom commands, ...).
+func stepKind(s *ninjaStep) string {
+	out := s.outputs[0]
+	switch path.Ext(out) {
+	case ".o", ".obj":
+		return "compile"
+	case ".a", ".so", ".dylib", ".lib", ".dll", ".exe":
+		return "link"
+	case "":
+		if strings.HasPrefix(out, "bin/") {
+			return "link"
+		}
+	}
+	return "other"
+}
+
+// slowest returns the n longest steps of kind, longest first.
+func slowest(steps []*ninjaStep, kind string, n int) []StepTime {
+	var matching []*ninjaStep
+	for _, s := range steps {
+		if stepKind(s) == kind {
+			matching = append(matching, s)
+		}
+	}
+	sort.SliceStable(matching, func(i, j int) bool {
+		return matching[i].duration() > matching[j].duration()
+	})
+	if len(matching) > n {
+		matching = matching[:n]
+	}
+
+	times := make([]StepTime, len(matching))
+	for i, s := range matching {
+		times[i] = StepTime{Output: s.outputs[0], Time: s.duration()}
+	}
+	return times
+}
+
+// totalDuration sums the durations of steps in seconds.
+func totalDuration(steps []*ninjaStep) float64 {
+	var ms int64
+	for _, s := range steps {
+		ms += s.end - s.start
+	}
+	return float64(ms) / 1000
+}
+
+func profileBuild(steps []*ninjaStep, inputs map[string][]string, targets []string) *BuildProfile {
+	p := &BuildProfile{
+		Steps:           len(steps),
+		SlowestCompiles: slowest(steps, "compile", profileTop),
+		SlowestLinks:    slowest(steps, "link", profileTop),
+		Final:           finalSteps(steps, inputs, targets),
+	}
+	p.CPUTime = totalDuration(steps)
+	var links []*ninjaStep
+	for _, s := range steps {
+		if stepKind(s) == "link" {
+			links = append(links, s)
+		}
+	}
+	p.LinkTime = totalDuration(links)
+	chain := criticalPath(steps, inputs)
+	p.CriticalPathSteps = len(chain)
+	p.CriticalPath = totalDuration(chain)
+	return p
+}
+
+// ninjaLogSize returns the current size of .ninja_log, or 0 if there is none
+// yet. Steps run by the next build are appended after this offset.
+func (b *builder) ninjaLogSize() (int64, error) {
+	fi, err := os.Stat(b.absPath(filepath.Join(b.out, ".ninja_log")))
+	if os.IsNotExist(err) {
+		return 0, nil
+	}
+	if err != nil {
+		return 0, err
+	}
+	return fi.Size(), nil
+}
+
+// profile builds a BuildProfile of the steps that were appended to
+// .ninja_log after offset when building targets.
+func (b *builder) profile(targets []string, offset int64) (*BuildProfile, error) {
+	f, err := os.Open(b.absPath(filepath.Join(b.out, ".ninja_log")))
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	_, err = f.Seek(offset, io.SeekStart)
+	if err != nil {
+		return nil, err
+	}
+	steps, err := parseNinjaLog(f)
+	if err != nil {
+		return nil, err
+	}
+
+	graph, err := b.ninjaOutput(append([]string{"-t", "graph"}, targets...)...)
+	if err != nil {
+		return nil, err
+	}
+	inputs, err := parseNinjaGraph(bytes.NewReader(graph))
+	if err != nil {
+		return nil, err
+	}
+
+	return profileBuild(steps, inputs, targets), nil
+}
+
+// printFinalSteps prints the median time of the steps that produced the
+// targets, such as the link of bin/llc, over all samples that ran them.
+func printFinalSteps(samples []*Sample) {
+	var outputs []string
+	times := map[string][]float64{}
+	for _, s := range samples {
+		if s.Profile == nil {
+			continue
+		}
+		for _, f := range s.Profile.Final {
+			if _, ok := times[f.Output]; !ok {
+				outputs = append(outputs, f.Output)
+			}
+			times[f.Output] = append(times[f.Output], f.Time)
+		}
+	}
+	for _, out := range outputs {
+		fmt.Printf("final step %s: median %.2fs of %d builds\n", out, median(times[out]), len(times[out]))
+	}
+}
+
+func printProfile(p *BuildProfile, wall float64) {
+	fmt.Println("build profile:")
+	fmt.Printf("  steps:         %d\n", p.Steps)
+	fmt.Printf("  parallelism:   %.1f (step time / wall time)\n", p.CPUTime/wall)
+	fmt.Printf("  critical path: %.1fs in %d steps (%.0f%% of wall time)\n",
+		p.CriticalPath, p.CriticalPathSteps, 100*p.CriticalPath/wall)
+	fmt.Printf("  link steps:    %.1fs in total\n", p.LinkTime)
+	for _, s := range p.Final {
+		fmt.Printf("  final step:    %.1fs  %s\n", s.Time, s.Output)
+	}
+	fmt.Println("  slowest compiles:")
+	for _, s := range p.SlowestCompiles {
+		fmt.Printf("    %7.1fs  %s\n", s.Time, s.Output)
+	}
+	fmt.Println("  slowest links:")
+	for _, s := range p.SlowestLinks {
+		fmt.Printf("    %7.1fs  %s\n", s.Time, s.Output)
+	}
+}
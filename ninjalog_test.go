@@ -0,0 +1,123 @@
+package main
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+)
+
+const testNinjaLog = "# ninja log v6\n" +
+	"0\t100\t0\tgen.inc\t1a\n" +
+	"100\t1100\t0\tlib/a.o\t2b\n" +
+	"100\t400\t0\tlib/b.o\t3c\n" +
+	"1100\t1500\t0\tlib/liba.a\t4d\n" +
+	"1500\t3500\t0\tbin/tool\t5e\n" +
+	"1500\t3500\t0\tbin/tool.map\t5e\n"
+
+// testNinjaGraph is what `ninja -t graph bin/tool` prints for the build above:
+// gen.inc is an order-only input of both objects, and bin/tool has two outputs
+// so it is drawn as an ellipse.
+const testNinjaGraph = `digraph ninja {
+rankdir="LR"
+node [fontsize=10, shape=box, height=0.25]
+edge [fontsize=10]
+"0x10" [label="bin/tool"]
+"0xe1" [label="CXX_EXECUTABLE_LINKER", shape=ellipse]
+"0xe1" -> "0x10"
+"0xe1" -> "0x11"
+"0x20" -> "0xe1" [arrowhead=none]
+"0x11" [label="bin/tool.map"]
+"0x20" [label="lib/liba.a"]
+"0xe2" [label="CXX_STATIC_LIBRARY_LINKER", shape=ellipse]
+"0xe2" -> "0x20"
+"0x30" -> "0xe2" [arrowhead=none]
+"0x31" -> "0xe2" [arrowhead=none]
+"0x30" [label="lib/a.o"]
+"0xe3" [label="CXX_COMPILER", shape=ellipse]
+"0xe3" -> "0x30"
+"0x40" -> "0xe3" [arrowhead=none]
+"0x50" -> "0xe3" [arrowhead=none style=dotted]
+"0x40" [label="../src/a.cpp"]
+"0x50" [label="gen.inc"]
+"0x41" -> "0x50" [label=" TABLEGEN"]
+"0x41" [label="../src/gen.td"]
+"0x31" [label="lib/b.o"]
+"0x42" -> "0x31" [label=" CXX_COMPILER"]
+"0x42" [label="../src/b.cpp"]
+"0x60" [label="tool"]
+"0x10" -> "0x60" [label=" phony"]
+}
+`
+
+func TestParseNinjaLog(t *testing.T) {
+	steps, err := parseNinjaLog(strings.NewReader(testNinjaLog))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(steps) != 5 {
+		t.Fatalf("got %d steps, want 5", len(steps))
+	}
+	last := steps[4]
+	if len(last.outputs) != 2 || last.outputs[1] != "bin/tool.map" || last.duration() != 2 {
+		t.Errorf("multi-output step not merged: %+v", last)
+	}
+}
+
+func TestParseNinjaQuery(t *testing.T) {
+	const query = `llc:
+  input: phony
+    bin/llc
+    | tools/llc/deps
+    || lib/order-only
+  outputs:
+    all
+`
+	rule, inputs, err := parseNinjaQuery(strings.NewReader(query))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if rule != "phony" {
+		t.Errorf("rule: got %q, want phony", rule)
+	}
+	if !reflect.DeepEqual(inputs, []string{"bin/llc"}) {
+		t.Errorf("inputs: got %q, want [bin/llc]", inputs)
+	}
+
+	_, _, err = parseNinjaQuery(strings.NewReader("ninja: error: unknown target 'x'\n"))
+	if err == nil {
+		t.Error("expected an error for output without an input edge")
+	}
+}
+
+func TestProfileBuild(t *testing.T) {
+	steps, err := parseNinjaLog(strings.NewReader(testNinjaLog))
+	if err != nil {
+		t.Fatal(err)
+	}
+	inputs, err := parseNinjaGraph(strings.NewReader(testNinjaGraph))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	p := profileBuild(steps, inputs, []string{"tool"})
+	// gen.inc -> lib/a.o -> lib/liba.a -> bin/tool
+	if p.CriticalPath != 3.5 || p.CriticalPathSteps != 4 {
+		t.Errorf("critical path: got %vs in %d steps, want 3.5s in 4 steps",
+			p.CriticalPath, p.CriticalPathSteps)
+	}
+	if p.CPUTime != 3.8 {
+		t.Errorf("cpu time: got %v, want 3.8", p.CPUTime)
+	}
+	if len(p.SlowestCompiles) != 2 || p.SlowestCompiles[0].Output != "lib/a.o" {
+		t.Errorf("slowest compiles: %+v", p.SlowestCompiles)
+	}
+	if len(p.SlowestLinks) != 2 || p.SlowestLinks[0].Output != "bin/tool" {
+		t.Errorf("slowest links: %+v", p.SlowestLinks)
+	}
+	if p.LinkTime != 2.4 {
+		t.Errorf("link time: got %v, want 2.4", p.LinkTime)
+	}
+	if len(p.Final) != 1 || p.Final[0] != (StepTime{"bin/tool", 2}) {
+		t.Errorf("final steps: %+v", p.Final)
+	}
+}
@@ -0,0 +1,109 @@
+package main
+
+import (
+	"fmt"
+	"log"
+	"math"
+	"os"
+	"sort"
+	"strings"
+	"syscall"
+
+	"github.com/afq984/BenchmarkV3/systemdetect"
+	"github.com/spf13/pflag"
+)
+
+var memPerJob float64
+
+func init() {
+	pflag.Float64Var(&memPerJob, "mem-per-job", 0, "limit ninja's -j so that every job has this many GiB of memory; 0 keeps ninja's default")
+}
+
+// ninjaDefaultJobs is the -j ninja picks by itself on nproc CPUs.
+func ninjaDefaultJobs(nproc int) int {
+	switch nproc {
+	case 0, 1:
+		return 2
+	case 2:
+		return 3
+	default:
+		return nproc + 2
+	}
+}
+
+// memoryJobs returns how many jobs of perJob GiB fit in memory bytes, at
+// least 1 and no more than ninja would run by itself on nproc CPUs.
+func memoryJobs(memory int64, perJob float64, nproc int) int {
+	jobs := int(float64(memory) / (perJob * (1 << 30)))
+	return max(1, min(jobs, ninjaDefaultJobs(nproc)))
+}
+
+// defaultJobs returns the -j of builds that do not ask for one: 0, for
+// ninja's default, unless --mem-per-job is set or the build is pinned to
+// some CPUs.
+func defaultJobs() int {
+	if memPerJob <= 0 {
+		if pinned != nil {
+			return ninjaDefaultJobs(len(pinned))
+		}
+		return 0
+	}
+	memory, err := systemdetect.Memory()
+	if err != nil {
+		log.Println("cannot detect memory, ignoring --mem-per-job:", err)
+		return 0
+	}
+	// The CPUs of --cgroup-cpuset count too, not just those pinned to.
+	nproc := cpuCount()
+	if cpus := buildCPUs(); len(cpus) > 0 {
+		nproc = len(cpus)
+	}
+	if l := cgroupLimits(); l != nil {
+		if l.Memory > 0 {
+			memory = min(memory, l.Memory)
+		}
+		if l.CPUs > 0 {
+			nproc = min(nproc, int(math.Ceil(l.CPUs)))
+		}
+	}
+	jobs := memoryJobs(memory, memPerJob, nproc)
+	log.Printf("%.1f GiB of memory at %.1f GiB per job: -j %d", float64(memory)/(1<<30), memPerJob, jobs)
+	return jobs
+}
+
+// oomKills counts the processes the kernel killed for running out of memory,
+// by the file the count was read from.
+type oomKills map[string]int64
+
+// diagnoseOOM returns why a build that failed with ps was probably killed for
+// running out of memory, or "" if nothing suggests it was. before is what
+// readOOMKills returned for cg before the build started.
+func diagnoseOOM(cg *cgroup, before oomKills, ps *os.ProcessState, jobs int) string {
+	var reasons []string
+	if ps != nil {
+		if ws, ok := ps.Sys().(syscall.WaitStatus); ok && ws.Signaled() && ws.Signal() == syscall.SIGKILL {
+			reasons = append(reasons, "ninja was killed by SIGKILL")
+		}
+	}
+	after := readOOMKills(cg)
+	sources := make([]string, 0, len(after))
+	for source := range after {
+		sources = append(sources, source)
+	}
+	sort.Strings(sources)
+	for _, source := range sources {
+		if n := after[source] - before[source]; n > 0 {
+			reasons = append(reasons, fmt.Sprintf("%d processes were OOM-killed according to %s", n, source))
+		}
+	}
+	if len(reasons) == 0 {
+		return ""
+	}
+
+	j := "ninja's default -j"
+	if jobs > 0 {
+		j = fmt.Sprintf("-j %d", jobs)
+	}
+	return fmt.Sprintf("the build ran out of memory with %s: %s; retry with fewer jobs, e.g. --mem-per-job 2",
+		j, strings.Join(reasons, ", "))
+}
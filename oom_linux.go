@@ -0,0 +1,92 @@
+package main
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+)
+
+// parseCounter returns the value of key in a file of "key value" lines, such
+// as /proc/vmstat or a cgroup's memory.events.
+func parseCounter(r io.Reader, key string) (int64, error) {
+	s := bufio.NewScanner(r)
+	for s.Scan() {
+		k, v, ok := strings.Cut(s.Text(), " ")
+		if !ok || k != key {
+			continue
+		}
+		n, err := strconv.ParseInt(v, 10, 64)
+		if err != nil {
+			return 0, fmt.Errorf("bad %s line: %q", key, s.Text())
+		}
+		return n, nil
+	}
+	if s.Err() != nil {
+		return 0, s.Err()
+	}
+	return 0, fmt.Errorf("no %s", key)
+}
+
+func readCounter(path, key string) (int64, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return 0, err
+	}
+	defer f.Close()
+	return parseCounter(f, key)
+}
+
+// parseCgroup returns the cgroup v2 path in /proc/self/cgroup, the line
+// "0::/user.slice/...". There is none on hosts with only cgroup v1.
+func parseCgroup(r io.Reader) (string, error) {
+	s := bufio.NewScanner(r)
+	for s.Scan() {
+		if path, ok := strings.CutPrefix(s.Text(), "0::"); ok {
+			return path, nil
+		}
+	}
+	if s.Err() != nil {
+		return "", s.Err()
+	}
+	return "", fmt.Errorf("no cgroup v2")
+}
+
+// ownCgroup returns the directory of the cgroup v2 this process is in.
+func ownCgroup() (string, error) {
+	f, err := os.Open("/proc/self/cgroup")
+	if err != nil {
+		return "", err
+	}
+	defer f.Close()
+	path, err := parseCgroup(f)
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join("/sys/fs/cgroup", path), nil
+}
+
+// readOOMKills reads the system-wide OOM kill count from /proc/vmstat and,
+// on cgroup v2, that of the cgroup the build runs in, cg or else our own,
+// which also counts kills from its own memory limit. Counts that cannot be
+// read are left out.
+func readOOMKills(cg *cgroup) oomKills {
+	kills := oomKills{}
+	if n, err := readCounter("/proc/vmstat", "oom_kill"); err == nil {
+		kills["/proc/vmstat"] = n
+	}
+	dir, err := ownCgroup()
+	if cg != nil {
+		dir, err = cg.dir, nil
+	}
+	if err == nil {
+		path := filepath.Join(dir, "memory.events")
+		if n, err := readCounter(path, "oom_kill"); err == nil {
+			kills[path] = n
+		}
+	}
+	return kills
+}
@@ -0,0 +1,47 @@
+package main
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestParseCounter(t *testing.T) {
+	const events = `low 0
+high 0
+max 12
+oom 3
+oom_kill 2
+oom_group_kill 0
+`
+	n, err := parseCounter(strings.NewReader(events), "oom_kill")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if n != 2 {
+		t.Errorf("got %d, want 2", n)
+	}
+
+	_, err = parseCounter(strings.NewReader(events), "pgfault")
+	if err == nil {
+		t.Error("expected an error for a missing key")
+	}
+}
+
+func TestParseCgroup(t *testing.T) {
+	const cgroup = `12:cpuset:/
+1:name=systemd:/user.slice
+0::/user.slice/user-1000.slice/session-2.scope
+`
+	path, err := parseCgroup(strings.NewReader(cgroup))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if path != "/user.slice/user-1000.slice/session-2.scope" {
+		t.Errorf("got %q", path)
+	}
+
+	_, err = parseCgroup(strings.NewReader("1:name=systemd:/\n"))
+	if err == nil {
+		t.Error("expected an error without a cgroup v2 line")
+	}
+}
@@ -0,0 +1,8 @@
+//go:build !linux
+
+package main
+
+// readOOMKills returns nil: only Linux counts OOM kills where they can be read.
+func readOOMKills(cg *cgroup) oomKills {
+	return nil
+}
@@ -0,0 +1,22 @@
+package main
+
+import "testing"
+
+func TestMemoryJobs(t *testing.T) {
+	for _, tc := range []struct {
+		memory int64
+		perJob float64
+		nproc  int
+		want   int
+	}{
+		{64 << 30, 2, 16, 18},   // plenty of memory: ninja's default
+		{16 << 30, 2, 64, 8},    // many cores, little memory
+		{16 << 30, 1.5, 64, 10}, // rounds down
+		{1 << 30, 2, 8, 1},      // never below 1
+		{8 << 30, 1, 1, 2},      // ninja runs 2 jobs on 1 CPU
+	} {
+		if got := memoryJobs(tc.memory, tc.perJob, tc.nproc); got != tc.want {
+			t.Errorf("memoryJobs(%d GiB, %v, %d) = %d, want %d", tc.memory>>30, tc.perJob, tc.nproc, got, tc.want)
+		}
+	}
+}
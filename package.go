@@ -3,5 +3,9 @@ package main
 import "context"
 
 type Package interface {
-	SetUp(ctx context.Context, buildDir string) error
+	// String identifies the package in logs and reports.
+	String() string
+	// SetUp makes the package available in buildDir, recording how long each
+	// step took in t.
+	SetUp(ctx context.Context, buildDir string, t *PackageTimes) error
 }
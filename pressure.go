@@ -0,0 +1,71 @@
+package main
+
+import "fmt"
+
+// memoryStallWarning is the share of the build time stalled on memory above
+// which the build time is reported as inflated by memory pressure.
+const memoryStallWarning = 0.01
+
+// Pressure is the pressure stall information (PSI) of a build: the share of
+// its wall time in which tasks were stalled waiting for each resource.
+type Pressure struct {
+	CPU    Stall `json:"cpu"`
+	Memory Stall `json:"memory"`
+	IO     Stall `json:"io"`
+
+	Points []PressurePoint `json:"points,omitempty"`
+}
+
+// Stall is the share of time, from 0 to 1, in which some tasks, or all
+// non-idle tasks at once, were stalled on a resource.
+type Stall struct {
+	Some float64 `json:"some"`
+	Full float64 `json:"full"`
+}
+
+// PressurePoint is the kernel's 10 second running average of the "some"
+// stall share of each resource, T seconds into the build, from 0 to 1.
+type PressurePoint struct {
+	T      float64 `json:"t"`
+	CPU    float64 `json:"cpu"`
+	Memory float64 `json:"memory"`
+	IO     float64 `json:"io"`
+}
+
+// totalPressure combines the pressure of several builds, weighting each by
+// its wall time. It returns nil if no build has pressure information.
+func totalPressure(samples []*Sample) *Pressure {
+	var total Pressure
+	var wall float64
+	add := func(sum *Stall, s Stall, w float64) {
+		sum.Some += s.Some * w
+		sum.Full += s.Full * w
+	}
+	for _, s := range samples {
+		if s.Pressure == nil {
+			continue
+		}
+		add(&total.CPU, s.Pressure.CPU, s.Time)
+		add(&total.Memory, s.Pressure.Memory, s.Time)
+		add(&total.IO, s.Pressure.IO, s.Time)
+		wall += s.Time
+	}
+	if wall == 0 {
+		return nil
+	}
+	for _, st := range []*Stall{&total.CPU, &total.Memory, &total.IO} {
+		st.Some /= wall
+		st.Full /= wall
+	}
+	return &total
+}
+
+func printPressure(p *Pressure) {
+	fmt.Println("pressure stalls (share of build time):")
+	fmt.Printf("  cpu:    some %5.1f%%\n", 100*p.CPU.Some)
+	fmt.Printf("  memory: some %5.1f%%  full %5.1f%%\n", 100*p.Memory.Some, 100*p.Memory.Full)
+	fmt.Printf("  io:     some %5.1f%%  full %5.1f%%\n", 100*p.IO.Some, 100*p.IO.Full)
+	if p.Memory.Full > memoryStallWarning {
+		fmt.Println("  warning: the build stalled on memory; swapping or reclaim inflated the build time")
+	}
+}
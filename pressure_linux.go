@@ -0,0 +1,118 @@
+package main
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// psi is one file of /proc/pressure.
+type psi struct {
+	someAvg10            float64 // percent
+	someTotal, fullTotal int64   // microseconds
+}
+
+// parsePSI parses a /proc/pressure file:
+//
+//	some avg10=0.00 avg60=0.00 avg300=0.00 total=12345
+//	full avg10=0.00 avg60=0.00 avg300=0.00 total=0
+//
+// Older kernels have no "full" line for cpu.
+func parsePSI(r io.Reader) (psi, error) {
+	var p psi
+	s := bufio.NewScanner(r)
+	for s.Scan() {
+		fields := strings.Fields(s.Text())
+		if len(fields) == 0 {
+			continue
+		}
+		for _, f := range fields[1:] {
+			key, value, ok := strings.Cut(f, "=")
+			if !ok {
+				return psi{}, fmt.Errorf("bad pressure line: %q", s.Text())
+			}
+			var err error
+			switch {
+			case fields[0] == "some" && key == "avg10":
+				p.someAvg10, err = strconv.ParseFloat(value, 64)
+			case fields[0] == "some" && key == "total":
+				p.someTotal, err = strconv.ParseInt(value, 10, 64)
+			case fields[0] == "full" && key == "total":
+				p.fullTotal, err = strconv.ParseInt(value, 10, 64)
+			}
+			if err != nil {
+				return psi{}, fmt.Errorf("bad pressure line: %q", s.Text())
+			}
+		}
+	}
+	return p, s.Err()
+}
+
+func readPSI(resource string) (psi, error) {
+	f, err := os.Open("/proc/pressure/" + resource)
+	if err != nil {
+		return psi{}, err
+	}
+	defer f.Close()
+	return parsePSI(f)
+}
+
+// pressureResources are the files of /proc/pressure, in the order of the
+// fields of Pressure.
+var pressureResources = []string{"cpu", "memory", "io"}
+
+// pressureMonitor records the stall totals before and after a build and
+// samples the running averages during it.
+type pressureMonitor struct {
+	t0     time.Time
+	before [3]psi
+	p      *Pressure
+}
+
+func newPressureMonitor() monitor {
+	m := &pressureMonitor{t0: time.Now(), p: &Pressure{}}
+	for i, res := range pressureResources {
+		var err error
+		m.before[i], err = readPSI(res)
+		if err != nil {
+			// The kernel has no PSI, or it is disabled (psi=0).
+			return nil
+		}
+	}
+	return m
+}
+
+func (m *pressureMonitor) sample(t time.Duration) {
+	var now [3]psi
+	for i, res := range pressureResources {
+		var err error
+		now[i], err = readPSI(res)
+		if err != nil {
+			return
+		}
+	}
+	m.p.Points = append(m.p.Points, PressurePoint{
+		T:      t.Seconds(),
+		CPU:    now[0].someAvg10 / 100,
+		Memory: now[1].someAvg10 / 100,
+		IO:     now[2].someAvg10 / 100,
+	})
+}
+
+func (m *pressureMonitor) finish(s *Sample) {
+	wall := float64(time.Since(m.t0).Microseconds())
+	stalls := []*Stall{&m.p.CPU, &m.p.Memory, &m.p.IO}
+	for i, res := range pressureResources {
+		after, err := readPSI(res)
+		if err != nil || wall == 0 {
+			return
+		}
+		stalls[i].Some = float64(after.someTotal-m.before[i].someTotal) / wall
+		stalls[i].Full = float64(after.fullTotal-m.before[i].fullTotal) / wall
+	}
+	s.Pressure = m.p
+}
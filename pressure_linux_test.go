@@ -0,0 +1,20 @@
+package main
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestParsePSI(t *testing.T) {
+	const memory = `some avg10=1.50 avg60=0.80 avg300=0.20 total=123456
+full avg10=0.50 avg60=0.10 avg300=0.00 total=6543
+`
+	p, err := parsePSI(strings.NewReader(memory))
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := psi{someAvg10: 1.5, someTotal: 123456, fullTotal: 6543}
+	if p != want {
+		t.Errorf("got %+v, want %+v", p, want)
+	}
+}
@@ -0,0 +1,159 @@
+//go:build unix
+
+package main
+
+import (
+	"errors"
+	"log"
+	"os"
+	"os/exec"
+	"strconv"
+	"strings"
+	"syscall"
+	"time"
+)
+
+// killGrace is how long the processes of a cancelled command get to exit
+// after SIGTERM before they are killed.
+var killGrace = 5 * time.Second
+
+// setProcessGroup makes cmd the leader of a new process group, so that a
+// terminal's Ctrl-C reaches only the benchmark and not cmd directly.
+func setProcessGroup(cmd *exec.Cmd) {
+	if cmd.SysProcAttr == nil {
+		cmd.SysProcAttr = &syscall.SysProcAttr{}
+	}
+	cmd.SysProcAttr.Setpgid = true
+}
+
+// process is one line of ps output.
+type process struct {
+	pid, ppid int
+	stat      string
+	args      string
+	line      string
+}
+
+// listProcesses returns the header and the processes of ps.
+func listProcesses() (string, []process, error) {
+	out, err := exec.Command("ps", "-A", "-o", "pid,ppid,stat,etime,time,args").Output()
+	if err != nil {
+		return "", nil, err
+	}
+	lines := strings.Split(strings.TrimSpace(string(out)), "\n")
+	var procs []process
+	for _, line := range lines[1:] {
+		fields := strings.Fields(line)
+		if len(fields) < 6 {
+			continue
+		}
+		pid, err1 := strconv.Atoi(fields[0])
+		ppid, err2 := strconv.Atoi(fields[1])
+		if err1 != nil || err2 != nil {
+			continue
+		}
+		procs = append(procs, process{
+			pid:  pid,
+			ppid: ppid,
+			stat: fields[2],
+			args: strings.Join(fields[5:], " "),
+			line: line,
+		})
+	}
+	return lines[0], procs, nil
+}
+
+// processTree returns the processes of procs that are roots or descend from
+// one. Zombies are left out, as they are already dead.
+func processTree(procs []process, roots []process) []process {
+	in := make(map[int]bool)
+	for _, r := range roots {
+		in[r.pid] = true
+	}
+	for changed := true; changed; {
+		changed = false
+		for _, p := range procs {
+			if !in[p.pid] && in[p.ppid] {
+				in[p.pid] = true
+				changed = true
+			}
+		}
+	}
+	var tree []process
+	for _, p := range procs {
+		if in[p.pid] && !strings.HasPrefix(p.stat, "Z") {
+			tree = append(tree, p)
+		}
+	}
+	return tree
+}
+
+// survivors returns the processes of old that are still running in procs,
+// and everything they started since. A process counts as the same if its pid
+// and command line match, so that a reused pid is not mistaken for it.
+func survivors(procs []process, old []process) []process {
+	same := make(map[int]string)
+	for _, p := range old {
+		same[p.pid] = p.args
+	}
+	var roots []process
+	for _, p := range procs {
+		if args, ok := same[p.pid]; ok && args == p.args {
+			roots = append(roots, p)
+		}
+	}
+	return processTree(procs, roots)
+}
+
+// dumpProcesses logs cmd and the processes it started, such as the
+// compilers a stuck ninja is waiting for.
+func dumpProcesses(cmd *exec.Cmd) {
+	header, procs, err := listProcesses()
+	if err != nil {
+		log.Println("cannot list processes:", err)
+		return
+	}
+	log.Println(header)
+	for _, p := range processTree(procs, []process{{pid: cmd.Process.Pid}}) {
+		log.Println(p.line)
+	}
+}
+
+// killProcessTree stops cmd and every process it started. ninja runs each
+// job in a process group of its own, so killing ninja's group would orphan
+// the compilers. Instead ninja gets SIGTERM, on which it signals its jobs
+// and waits for them. Whatever of the tree is still running after killGrace
+// is killed.
+func killProcessTree(cmd *exec.Cmd) error {
+	pid := cmd.Process.Pid
+	_, procs, err := listProcesses()
+	if err != nil {
+		log.Println("cannot list processes:", err)
+	}
+	tree := processTree(procs, []process{{pid: pid}})
+
+	err = syscall.Kill(-pid, syscall.SIGTERM)
+	if errors.Is(err, syscall.ESRCH) {
+		err = os.ErrProcessDone
+	}
+	deadline := time.Now().Add(killGrace)
+	for {
+		_, procs, lerr := listProcesses()
+		if lerr == nil {
+			tree = survivors(procs, tree)
+		}
+		if len(tree) == 0 {
+			return err
+		}
+		if lerr != nil || time.Now().After(deadline) {
+			break
+		}
+		time.Sleep(100 * time.Millisecond)
+	}
+	syscall.Kill(-pid, syscall.SIGKILL)
+	for _, p := range tree {
+		log.Println("killing leftover process:", p.line)
+		syscall.Kill(p.pid, syscall.SIGKILL)
+	}
+	return err
+}
@@ -0,0 +1,81 @@
+//go:build unix
+
+package main
+
+import (
+	"bufio"
+	"context"
+	"os/exec"
+	"slices"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestKillProcessTree(t *testing.T) {
+	if _, err := exec.LookPath("setsid"); err != nil {
+		t.Skip("no setsid")
+	}
+	defer func(d time.Duration) { killGrace = d }(killGrace)
+	killGrace = 500 * time.Millisecond
+
+	// The child leaves the process group, as ninja's jobs do, and the
+	// shell does not pass SIGTERM on, so only the fallback can kill it.
+	ctx, cancel := context.WithCancel(context.Background())
+	cmd := command(ctx, nil, "sh", "-c", "setsid sleep 300 & echo $!; wait")
+	cmd.Stdout = nil
+	stdout, err := cmd.StdoutPipe()
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = cmd.Start()
+	if err != nil {
+		t.Fatal(err)
+	}
+	line, err := bufio.NewReader(stdout).ReadString('\n')
+	if err != nil {
+		t.Fatal(err)
+	}
+	child, err := strconv.Atoi(strings.TrimSpace(line))
+	if err != nil {
+		t.Fatal(err)
+	}
+	cancel()
+	cmd.Wait()
+
+	// The child may linger as a zombie if nothing reaps orphans.
+	out, _ := exec.Command("ps", "-o", "stat=", "-p", strconv.Itoa(child)).Output()
+	if stat := strings.TrimSpace(string(out)); stat != "" && !strings.HasPrefix(stat, "Z") {
+		t.Errorf("child %d still running after cancel (%s)", child, stat)
+	}
+}
+
+func TestProcessTree(t *testing.T) {
+	procs := []process{
+		{pid: 1, ppid: 0, stat: "S"},
+		{pid: 10, ppid: 1, stat: "S", args: "ninja"},
+		{pid: 11, ppid: 10, stat: "S", args: "clang"},
+		{pid: 12, ppid: 11, stat: "R", args: "clang -cc1"},
+		{pid: 13, ppid: 10, stat: "Z", args: "clang"},
+		{pid: 20, ppid: 1, stat: "S", args: "other"},
+	}
+	var pids []int
+	for _, p := range processTree(procs, []process{{pid: 10}}) {
+		pids = append(pids, p.pid)
+	}
+	if want := []int{10, 11, 12}; !slices.Equal(pids, want) {
+		t.Errorf("processTree = %v, want %v", pids, want)
+	}
+
+	// ninja exited, and pid 11 was reused by another program.
+	later := []process{
+		{pid: 1, ppid: 0, stat: "S"},
+		{pid: 11, ppid: 1, stat: "S", args: "unrelated"},
+		{pid: 12, ppid: 1, stat: "R", args: "clang -cc1"},
+	}
+	left := survivors(later, processTree(procs, []process{{pid: 10}}))
+	if len(left) != 1 || left[0].pid != 12 {
+		t.Errorf("survivors = %+v, want only pid 12", left)
+	}
+}
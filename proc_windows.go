@@ -0,0 +1,34 @@
+package main
+
+import (
+	"log"
+	"os/exec"
+	"strconv"
+	"syscall"
+)
+
+// setProcessGroup starts cmd in a new process group, so that Ctrl-C reaches
+// only the benchmark, which then kills the tree itself.
+func setProcessGroup(cmd *exec.Cmd) {
+	if cmd.SysProcAttr == nil {
+		cmd.SysProcAttr = &syscall.SysProcAttr{}
+	}
+	cmd.SysProcAttr.CreationFlags |= syscall.CREATE_NEW_PROCESS_GROUP
+}
+
+// dumpProcesses logs the running processes. Windows cannot list a process
+// tree directly, so this lists them all.
+func dumpProcesses(cmd *exec.Cmd) {
+	out, err := exec.Command("tasklist", "/V").Output()
+	if err != nil {
+		log.Println("cannot list processes:", err)
+		return
+	}
+	log.Print(string(out))
+}
+
+// killProcessTree kills cmd and every process it started. Windows process
+// groups cannot be killed as a whole, so taskkill walks the process tree.
+func killProcessTree(cmd *exec.Cmd) error {
+	return exec.Command("taskkill", "/T", "/F", "/PID", strconv.Itoa(cmd.Process.Pid)).Run()
+}
@@ -1,21 +1,140 @@
 package main
 
 import (
+	"encoding/json"
 	"net/url"
 	"os"
 	"strconv"
+	"time"
 
 	"github.com/afq984/BenchmarkV3/systemdetect"
 )
 
 type Result struct {
+	// Time is the median of Samples; it is the figure that gets submitted.
+	// In a --sweep it is the median of the fastest job count instead, which
+	// is added to Misc, and tracks with their own Track.Measure define it
+	// themselves. With --throughput it is the wall time of the builds run
+	// side by side divided by their number.
 	Time     float64 `json:"time"`
 	Track    string  `json:"track"`
 	Config   string  `json:"config"`
 	Hostname string  `json:"hostname"`
 	CPU      string  `json:"cpu"`
 	Memory   int64   `json:"memory"`
-	Misc     string  `json:"misc"`
+	// Pressure is how much the timed builds stalled on CPU, memory and I/O,
+	// on kernels with PSI. Memory stalls mean Memory was too small.
+	Pressure *Pressure `json:"pressure,omitempty"`
+	Misc     string    `json:"misc"`
+	// Limits are the cgroup limits of the timed builds, if any. They are also
+	// added to Misc so that a constrained result is never submitted as one of
+	// the whole machine.
+	Limits *Limits `json:"limits,omitempty"`
+	// Affinity is the cpulist cmake and ninja were pinned to with --cpus or
+	// --core-type, and CoreType the --core-type. Both are added to Misc too.
+	Affinity string `json:"affinity,omitempty"`
+	CoreType string `json:"core_type,omitempty"`
+
+	// WorkDir is where the build tree was created, and Filesystem the type
+	// of the filesystem it is on, which affects the build time.
+	WorkDir    string `json:"work_dir,omitempty"`
+	Filesystem string `json:"filesystem,omitempty"`
+
+	Samples []*Sample     `json:"samples,omitempty"`
+	Sweep   []*SweepPoint `json:"sweep,omitempty"`
+	// Throughput is set by --throughput. It is added to Misc too, as Time is
+	// then not the time of a single build.
+	Throughput *Throughput `json:"throughput,omitempty"`
+	// UnityRatio is the median unity build time of the unity track divided
+	// by the median normal build time; below 1 the unity build is faster.
+	UnityRatio float64 `json:"unity_ratio,omitempty"`
+	Phases     *Phases `json:"phases,omitempty"`
+}
+
+// Phases is the wall time in seconds of each phase of the benchmark, not just
+// of the timed build. Disk and decompression speed show up in SetUp.
+type Phases struct {
+	// SetUp is the parallel download, check and extraction of all packages;
+	// Packages breaks it down per package.
+	SetUp    float64                  `json:"setup"`
+	Packages map[string]*PackageTimes `json:"packages"`
+	// SetUpDisk is the disk I/O during SetUp, mostly from extraction.
+	SetUpDisk *DiskIO `json:"setup_disk,omitempty"`
+	// Toolchain is writing the cmake toolchain file, linking clang-bin and
+	// setting up the libxml2 stub.
+	Toolchain float64 `json:"toolchain"`
+	// Configure is cmake configuring the tree, which runs thousands of
+	// try_compile probes one at a time and so mostly measures how fast the
+	// system starts processes.
+	Configure float64 `json:"configure"`
+	// ConfigureRuns are the times of the --configure-runs extra configures,
+	// each into a fresh output directory.
+	ConfigureRuns []float64 `json:"configure_runs,omitempty"`
+	// NormalConfigure is configuring the tree without unity builds that the
+	// unity track compares with.
+	NormalConfigure float64 `json:"normal_configure,omitempty"`
+	// ThroughputConfigure is configuring the extra trees of --throughput.
+	ThroughputConfigure float64 `json:"throughput_configure,omitempty"`
+	// Build is the sum of all timed builds.
+	Build float64 `json:"build"`
+	// Reused is set when the build tree came from --reuse, so that setting
+	// it up and configuring it were skipped.
+	Reused bool `json:"reused,omitempty"`
+}
+
+// PackageTimes is how long setting up one package took, in seconds. A step
+// that did not run, such as downloading an archive that is already cached,
+// is 0.
+type PackageTimes struct {
+	Download float64 `json:"download"`
+	Check    float64 `json:"check"`
+	Extract  float64 `json:"extract"`
+	// Size is the size of the archive in bytes.
+	Size int64 `json:"size,omitempty"`
+}
+
+// timed runs f and adds its wall time in seconds to *d.
+func timed(d *float64, f func() error) error {
+	t0 := time.Now()
+	err := f()
+	*d += time.Since(t0).Seconds()
+	return err
+}
+
+// Sample is the measurement of one timed build.
+type Sample struct {
+	// Name tells apart the different builds of a track, such as the full
+	// build and the rebuilds of the incremental track. It is empty for
+	// tracks with only one kind of build.
+	Name string `json:"name,omitempty"`
+	// Jobs is the -j passed to ninja, or 0 for ninja's default.
+	Jobs int `json:"jobs,omitempty"`
+	// Time is the wall time of the build in seconds.
+	Time float64 `json:"time"`
+
+	Profile  *BuildProfile    `json:"profile,omitempty"`
+	Rusage   *Rusage          `json:"rusage,omitempty"`
+	CPU      *CPUTimeline     `json:"cpu,omitempty"`
+	Thermal  *ThermalTimeline `json:"thermal,omitempty"`
+	Disk     *DiskIO          `json:"disk,omitempty"`
+	Pressure *Pressure        `json:"pressure,omitempty"`
+	// PeakDirSize is the largest size of the cmake output directory during
+	// the build, in bytes. Only tracks with a MinFree measure it.
+	PeakDirSize int64 `json:"peak_dir_size,omitempty"`
+}
+
+// times returns the wall time of every sample of r, in order.
+func (r *Result) times() []float64 {
+	return times(r.Samples)
+}
+
+// times returns the wall time of every sample, in order.
+func times(samples []*Sample) []float64 {
+	ts := make([]float64, len(samples))
+	for i, s := range samples {
+		ts[i] = s.Time
+	}
+	return ts
 }
 
 const unknown = "<unknown>"
@@ -68,3 +187,12 @@ func submissionURL(r *Result) string {
 
 	return u.String()
 }
+
+// writeResultJSON writes r, including all of its samples, to path.
+func writeResultJSON(path string, r *Result) error {
+	b, err := json.MarshalIndent(r, "", "  ")
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(path, append(b, '\n'), 0644)
+}
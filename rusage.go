@@ -0,0 +1,64 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"slices"
+)
+
+// Rusage is the resource usage of a build: ninja and every process it ran.
+// It is not collected on Windows, which does not count the children.
+type Rusage struct {
+	// User and System are CPU times in seconds.
+	User   float64 `json:"user"`
+	System float64 `json:"system"`
+	// MaxRSS is the peak resident set size in bytes of the largest single
+	// process, typically a link or a big translation unit. It is 0 where the
+	// OS does not report it.
+	MaxRSS      int64 `json:"max_rss,omitempty"`
+	MinorFaults int64 `json:"minor_faults,omitempty"`
+	MajorFaults int64 `json:"major_faults,omitempty"`
+}
+
+// CPUTime is the total CPU time in seconds. It does not depend on the number
+// of cores, so two builds that did the same work should have a similar
+// CPUTime.
+func (u *Rusage) CPUTime() float64 {
+	return u.User + u.System
+}
+
+// rusage returns the resource usage of the process described by ps, which
+// includes the children it waited for, or nil where the OS does not count
+// the children.
+func rusage(ps *os.ProcessState) *Rusage {
+	u := &Rusage{
+		User:   ps.UserTime().Seconds(),
+		System: ps.SystemTime().Seconds(),
+	}
+	if !sysRusage(ps, u) {
+		return nil
+	}
+	return u
+}
+
+// printRusage prints the resource usage of samples, or nothing if none was
+// collected.
+func printRusage(samples []*Sample) {
+	if !slices.ContainsFunc(samples, func(s *Sample) bool { return s.Rusage != nil }) {
+		return
+	}
+	fmt.Println("resource usage:")
+	for i, s := range samples {
+		u := s.Rusage
+		if u == nil {
+			continue
+		}
+		fmt.Printf("  build %d: %.0f CPU-seconds (user %.0fs, sys %.0fs), %.1fx wall time",
+			i+1, u.CPUTime(), u.User, u.System, u.CPUTime()/s.Time)
+		if u.MaxRSS > 0 {
+			fmt.Printf(", peak RSS %.0f MiB, %d major faults", float64(u.MaxRSS)/(1<<20), u.MajorFaults)
+		}
+		fmt.Println()
+	}
+	fmt.Println()
+}
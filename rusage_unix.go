@@ -0,0 +1,26 @@
+//go:build unix
+
+package main
+
+import (
+	"os"
+	"runtime"
+	"syscall"
+)
+
+// sysRusage fills in the fields of u that only the unix rusage has. The CPU
+// times include the waited-for children, so u is always usable.
+func sysRusage(ps *os.ProcessState, u *Rusage) bool {
+	ru, ok := ps.SysUsage().(*syscall.Rusage)
+	if !ok {
+		return true
+	}
+	// ru_maxrss is in kilobytes on Linux but in bytes on macOS.
+	u.MaxRSS = int64(ru.Maxrss)
+	if runtime.GOOS != "darwin" {
+		u.MaxRSS *= 1024
+	}
+	u.MinorFaults = int64(ru.Minflt)
+	u.MajorFaults = int64(ru.Majflt)
+	return true
+}
@@ -0,0 +1,10 @@
+package main
+
+import "os"
+
+// sysRusage reports that there is no usable rusage: Windows reports no peak
+// memory or page faults in the process state, and its CPU times only cover
+// ninja itself, not the compilers it ran.
+func sysRusage(ps *os.ProcessState, u *Rusage) bool {
+	return false
+}
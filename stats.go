@@ -0,0 +1,55 @@
+package main
+
+import (
+	"math"
+	"sort"
+)
+
+// Stats summarizes repeated measurements of the same quantity.
+type Stats struct {
+	Min    float64 `json:"min"`
+	Median float64 `json:"median"`
+	Mean   float64 `json:"mean"`
+	Stddev float64 `json:"stddev"`
+}
+
+// summarize computes Stats over xs, which must not be empty. Stddev is the
+// sample standard deviation, and is 0 for a single measurement.
+func summarize(xs []float64) Stats {
+	sum := 0.0
+	for _, x := range xs {
+		sum += x
+	}
+	mean := sum / float64(len(xs))
+
+	var stddev float64
+	if len(xs) > 1 {
+		ss := 0.0
+		for _, x := range xs {
+			ss += (x - mean) * (x - mean)
+		}
+		stddev = math.Sqrt(ss / float64(len(xs)-1))
+	}
+
+	sorted := append([]float64(nil), xs...)
+	sort.Float64s(sorted)
+
+	return Stats{
+		Min:    sorted[0],
+		Median: median(xs),
+		Mean:   mean,
+		Stddev: stddev,
+	}
+}
+
+// median returns the median of xs, which must not be empty. xs is not
+// modified.
+func median(xs []float64) float64 {
+	sorted := append([]float64(nil), xs...)
+	sort.Float64s(sorted)
+	n := len(sorted)
+	if n%2 == 1 {
+		return sorted[n/2]
+	}
+	return (sorted[n/2-1] + sorted[n/2]) / 2
+}
@@ -0,0 +1,36 @@
+package main
+
+import (
+	"math"
+	"testing"
+)
+
+func TestSummarize(t *testing.T) {
+	got := summarize([]float64{4, 1, 3, 2})
+	want := Stats{Min: 1, Median: 2.5, Mean: 2.5, Stddev: math.Sqrt(5.0 / 3)}
+	if math.Abs(got.Stddev-want.Stddev) > 1e-12 {
+		t.Errorf("stddev: got %v, want %v", got.Stddev, want.Stddev)
+	}
+	got.Stddev = want.Stddev
+	if got != want {
+		t.Errorf("got %+v, want %+v", got, want)
+	}
+}
+
+func TestSummarizeSingle(t *testing.T) {
+	got := summarize([]float64{42})
+	want := Stats{Min: 42, Median: 42, Mean: 42, Stddev: 0}
+	if got != want {
+		t.Errorf("got %+v, want %+v", got, want)
+	}
+}
+
+func TestMedianOdd(t *testing.T) {
+	xs := []float64{5, 1, 3}
+	if got := median(xs); got != 3 {
+		t.Errorf("got %v, want 3", got)
+	}
+	if xs[0] != 5 {
+		t.Errorf("median modified its input: %v", xs)
+	}
+}
@@ -0,0 +1,112 @@
+package main
+
+import (
+	"fmt"
+	"log"
+	"slices"
+
+	"github.com/spf13/pflag"
+)
+
+var (
+	sweep        bool
+	sweepJobList []int
+)
+
+func init() {
+	pflag.BoolVar(&sweep, "sweep", false, "time the build at several ninja -j values and report the scaling curve")
+	pflag.IntSliceVar(&sweepJobList, "sweep-jobs", nil, "job counts for --sweep (default 1, 2, 4 ... nproc, 2*nproc)")
+}
+
+// SweepPoint is the result of building at one job count. Speedup and
+// Efficiency are relative to the first (smallest) job count of the sweep, so
+// with the default job counts they are relative to a serial build.
+type SweepPoint struct {
+	Jobs       int     `json:"jobs"`
+	Time       float64 `json:"time"`
+	Speedup    float64 `json:"speedup"`
+	Efficiency float64 `json:"efficiency"`
+}
+
+// defaultSweepJobs returns the powers of two below nproc, nproc itself and
+// twice nproc, which is roughly what ninja's default (nproc+2) oversubscribes
+// towards.
+func defaultSweepJobs(nproc int) []int {
+	var jobs []int
+	for j := 1; j < nproc; j *= 2 {
+		jobs = append(jobs, j)
+	}
+	return append(jobs, nproc, 2*nproc)
+}
+
+// sortJobs returns the job counts of --sweep-jobs sorted and without
+// duplicates, so that the first point of the sweep is the smallest.
+func sortJobs(jobs []int) ([]int, error) {
+	for _, j := range jobs {
+		if j < 1 {
+			return nil, fmt.Errorf("--sweep-jobs must be at least 1, got %d", j)
+		}
+	}
+	jobs = slices.Clone(jobs)
+	slices.Sort(jobs)
+	return slices.Compact(jobs), nil
+}
+
+// scaling fills in Speedup and Efficiency of points from their times.
+func scaling(points []*SweepPoint) {
+	if len(points) == 0 {
+		return
+	}
+	base := points[0]
+	for _, p := range points {
+		p.Speedup = base.Time / p.Time
+		p.Efficiency = p.Speedup * float64(base.Jobs) / float64(p.Jobs)
+	}
+}
+
+// sweepJobs times targets at every job count of the sweep, each --runs times,
+// and stores the samples and the scaling curve in r.
+func sweepJobs(b *builder, targets []string, r *Result) error {
+	jobs := sweepJobList
+	if len(jobs) == 0 {
+		jobs = defaultSweepJobs(cpuCount())
+	}
+
+	for _, j := range jobs {
+		log.Printf("sweep: building with -j %d", j)
+		samples, err := b.timedBuilds(targets, j, runs)
+		if err != nil {
+			return err
+		}
+		r.Samples = append(r.Samples, samples...)
+
+		ts := make([]float64, len(samples))
+		for i, s := range samples {
+			ts[i] = s.Time
+		}
+		r.Sweep = append(r.Sweep, &SweepPoint{Jobs: j, Time: median(ts)})
+	}
+	scaling(r.Sweep)
+
+	r.Time = fastest(r.Sweep).Time
+	return nil
+}
+
+// fastest returns the point of the sweep with the shortest time.
+func fastest(points []*SweepPoint) *SweepPoint {
+	best := points[0]
+	for _, p := range points {
+		if p.Time < best.Time {
+			best = p
+		}
+	}
+	return best
+}
+
+func printSweep(points []*SweepPoint) {
+	fmt.Println("parallel scaling:")
+	fmt.Println("  jobs       time   speedup  efficiency")
+	for _, p := range points {
+		fmt.Printf("  %4d  %8.1fs  %7.2fx  %9.1f%%\n", p.Jobs, p.Time, p.Speedup, 100*p.Efficiency)
+	}
+}
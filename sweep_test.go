@@ -0,0 +1,55 @@
+package main
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestDefaultSweepJobs(t *testing.T) {
+	for _, tc := range []struct {
+		nproc int
+		want  []int
+	}{
+		{1, []int{1, 2}},
+		{4, []int{1, 2, 4, 8}},
+		{6, []int{1, 2, 4, 6, 12}},
+	} {
+		if got := defaultSweepJobs(tc.nproc); !reflect.DeepEqual(got, tc.want) {
+			t.Errorf("defaultSweepJobs(%d) = %v, want %v", tc.nproc, got, tc.want)
+		}
+	}
+}
+
+func TestScaling(t *testing.T) {
+	points := []*SweepPoint{
+		{Jobs: 2, Time: 100},
+		{Jobs: 4, Time: 50},
+		{Jobs: 8, Time: 40},
+	}
+	scaling(points)
+	for i, want := range []struct{ speedup, efficiency float64 }{
+		{1, 1},
+		{2, 1},
+		{2.5, 0.625},
+	} {
+		if points[i].Speedup != want.speedup || points[i].Efficiency != want.efficiency {
+			t.Errorf("point %d: got speedup %v efficiency %v, want %v %v",
+				i, points[i].Speedup, points[i].Efficiency, want.speedup, want.efficiency)
+		}
+	}
+}
+
+func TestSortJobs(t *testing.T) {
+	got, err := sortJobs([]int{16, 4, 8, 4})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := []int{4, 8, 16}; !reflect.DeepEqual(got, want) {
+		t.Errorf("got %v, want %v", got, want)
+	}
+	for _, bad := range [][]int{{0}, {4, -1}} {
+		if _, err := sortJobs(bad); err == nil {
+			t.Errorf("sortJobs(%v): expected an error", bad)
+		}
+	}
+}
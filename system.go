@@ -14,7 +14,11 @@ type System struct {
 
 var _ Package = &System{}
 
-func (s *System) SetUp(ctx context.Context, buildDir string) error {
+func (s *System) String() string {
+	return s.Name
+}
+
+func (s *System) SetUp(ctx context.Context, buildDir string, t *PackageTimes) error {
 	p, err := exec.LookPath(s.Name)
 	if err != nil {
 		log.Printf("cannot find %q in system path", s.Name)
@@ -19,6 +19,49 @@ func run(name string, arg ...string) (string, error) {
 	return string(bytes.TrimRight(b, "\n")), nil
 }
 
+// ParseCPUList parses a Linux cpulist such as "0-3,8,10-11", as in
+// /sys/devices/system/cpu/online or taskset -c, into CPU numbers.
+func ParseCPUList(s string) ([]int, error) {
+	var cpus []int
+	for _, r := range strings.Split(s, ",") {
+		lo, hi, isRange := strings.Cut(r, "-")
+		first, err := strconv.Atoi(lo)
+		if err != nil {
+			return nil, fmt.Errorf("bad cpulist %q", s)
+		}
+		last := first
+		if isRange {
+			last, err = strconv.Atoi(hi)
+			if err != nil || last < first {
+				return nil, fmt.Errorf("bad cpulist %q", s)
+			}
+		}
+		for cpu := first; cpu <= last; cpu++ {
+			cpus = append(cpus, cpu)
+		}
+	}
+	return cpus, nil
+}
+
+// FormatCPUList formats sorted CPU numbers as a cpulist, the inverse of
+// ParseCPUList.
+func FormatCPUList(cpus []int) string {
+	var ranges []string
+	for i := 0; i < len(cpus); {
+		j := i
+		for j+1 < len(cpus) && cpus[j+1] == cpus[j]+1 {
+			j++
+		}
+		if j == i {
+			ranges = append(ranges, strconv.Itoa(cpus[i]))
+		} else {
+			ranges = append(ranges, fmt.Sprintf("%d-%d", cpus[i], cpus[j]))
+		}
+		i = j + 1
+	}
+	return strings.Join(ranges, ",")
+}
+
 func keyValueGet(r io.Reader, key string) (string, error) {
 	s := bufio.NewScanner(r)
 	for s.Scan() {
@@ -3,6 +3,7 @@ package systemdetect
 import (
 	"fmt"
 	"strconv"
+	"syscall"
 )
 
 func Cpu() (string, error) {
@@ -36,3 +37,38 @@ func Memory() (int64, error) {
 func Misc() (string, error) {
 	return run("sysctl", "-n", "hw.model")
 }
+
+// Filesystem returns the type of the filesystem that holds path, such as
+// "apfs".
+func Filesystem(path string) (string, error) {
+	var st syscall.Statfs_t
+	err := syscall.Statfs(path, &st)
+	if err != nil {
+		return "", err
+	}
+	var name []byte
+	for _, c := range st.Fstypename {
+		if c == 0 {
+			break
+		}
+		name = append(name, byte(c))
+	}
+	return string(name), nil
+}
+
+// DiskFree returns the bytes available to unprivileged users on the
+// filesystem that holds path.
+func DiskFree(path string) (int64, error) {
+	var st syscall.Statfs_t
+	err := syscall.Statfs(path, &st)
+	if err != nil {
+		return -1, err
+	}
+	return int64(st.Bavail) * int64(st.Bsize), nil
+}
+
+// CoreTypes is only implemented on Linux, where the build can be pinned to
+// one type of core.
+func CoreTypes() (performance, efficiency []int, err error) {
+	return nil, nil, fmt.Errorf("core types are not detected on macOS")
+}
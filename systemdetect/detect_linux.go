@@ -5,6 +5,7 @@ import (
 	"fmt"
 	"io"
 	"os"
+	"path/filepath"
 	"sort"
 	"strconv"
 	"strings"
@@ -184,32 +185,58 @@ type cpuCluster struct {
 // so the logical core count is also the physical core count. big.LITTLE SoCs
 // report several distinct parts; each becomes a "Nx <core name>" group.
 func cpuARM(blocks []map[string]string) (string, error) {
-	counts := make(map[cpuCluster]int)
-	var order []cpuCluster
+	order, cpus, err := armClusters(blocks)
+	if err != nil {
+		return "", err
+	}
+
+	var name string
 	total := 0
-	for _, b := range blocks {
+	if len(order) == 1 {
+		name = cpuPartName(order[0].impl, order[0].part)
+		total = len(cpus[order[0]])
+	} else {
+		clusters := make([]string, len(order))
+		for i, c := range order {
+			clusters[i] = fmt.Sprintf("%dx %s", len(cpus[c]), cpuPartName(c.impl, c.part))
+			total += len(cpus[c])
+		}
+		name = strings.Join(clusters, " + ")
+	}
+
+	return fmt.Sprintf("%dC%dT %q", total, total, name), nil
+}
+
+// armClusters groups the arm64 cores of /proc/cpuinfo into clusters, and
+// returns the clusters and the CPU numbers of the cores of each.
+func armClusters(blocks []map[string]string) (order []cpuCluster, cpus map[cpuCluster][]int, err error) {
+	cpus = make(map[cpuCluster][]int)
+	for i, b := range blocks {
 		partStr, ok := b["CPU part"]
 		if !ok {
 			continue
 		}
 		part, err := parseHexField(partStr)
 		if err != nil {
-			return "", fmt.Errorf("bad %q: %q", "CPU part", partStr)
+			return nil, nil, fmt.Errorf("bad %q: %q", "CPU part", partStr)
 		}
 		impl, err := parseHexField(b["CPU implementer"])
 		if err != nil {
 			// implementer is optional for our purposes; default to 0 (unknown).
 			impl = 0
 		}
+		cpu, err := atoiField(b, "processor")
+		if err != nil {
+			cpu = i
+		}
 		c := cpuCluster{impl, part}
-		if counts[c] == 0 {
+		if len(cpus[c]) == 0 {
 			order = append(order, c)
 		}
-		counts[c]++
-		total++
+		cpus[c] = append(cpus[c], cpu)
 	}
-	if total == 0 {
-		return "", fmt.Errorf("no CPU part entries found in /proc/cpuinfo")
+	if len(order) == 0 {
+		return nil, nil, fmt.Errorf("no CPU part entries found in /proc/cpuinfo")
 	}
 
 	// Sort clusters by descending part id so the largest/newest cores (which
@@ -221,19 +248,120 @@ func cpuARM(blocks []map[string]string) (string, error) {
 		}
 		return order[i].impl < order[j].impl
 	})
+	return order, cpus, nil
+}
 
-	var name string
-	if len(order) == 1 {
-		name = cpuPartName(order[0].impl, order[0].part)
-	} else {
-		clusters := make([]string, len(order))
-		for i, c := range order {
-			clusters[i] = fmt.Sprintf("%dx %s", counts[c], cpuPartName(c.impl, c.part))
+// coreTypesARM splits the arm64 clusters into the performance cores, those of
+// the cluster with the highest part number, and the efficiency cores, those
+// with the lowest. Cores of the clusters in between are of neither type.
+func coreTypesARM(blocks []map[string]string) (performance, efficiency []int, err error) {
+	order, cpus, err := armClusters(blocks)
+	if err != nil {
+		return nil, nil, err
+	}
+	if len(order) < 2 {
+		return nil, nil, fmt.Errorf("all cores are of one type")
+	}
+	performance = cpus[order[0]]
+	efficiency = cpus[order[len(order)-1]]
+	sort.Ints(performance)
+	sort.Ints(efficiency)
+	return performance, efficiency, nil
+}
+
+// coreTypesCapacity splits the CPUs by their capacity, the relative speed the
+// kernel's scheduler assigns them: the performance cores have the highest
+// capacity and the efficiency cores the lowest. Cores in between, such as the
+// middle cluster of a three-cluster SoC, are of neither type.
+func coreTypesCapacity(capacity map[int]int64) (performance, efficiency []int, err error) {
+	if len(capacity) == 0 {
+		return nil, nil, fmt.Errorf("no cpu_capacity")
+	}
+	var lo, hi int64 = -1, -1
+	for _, c := range capacity {
+		if lo < 0 || c < lo {
+			lo = c
+		}
+		hi = max(hi, c)
+	}
+	if lo == hi {
+		return nil, nil, fmt.Errorf("all cores are of one type")
+	}
+	for cpu, c := range capacity {
+		switch c {
+		case hi:
+			performance = append(performance, cpu)
+		case lo:
+			efficiency = append(efficiency, cpu)
 		}
-		name = strings.Join(clusters, " + ")
 	}
+	sort.Ints(performance)
+	sort.Ints(efficiency)
+	return performance, efficiency, nil
+}
 
-	return fmt.Sprintf("%dC%dT %q", total, total, name), nil
+// readCapacities returns the cpu_capacity of every CPU that has one.
+func readCapacities() map[int]int64 {
+	paths, _ := filepath.Glob("/sys/devices/system/cpu/cpu[0-9]*/cpu_capacity")
+	capacity := make(map[int]int64)
+	for _, p := range paths {
+		cpu, err := strconv.Atoi(strings.TrimPrefix(filepath.Base(filepath.Dir(p)), "cpu"))
+		if err != nil {
+			continue
+		}
+		b, err := os.ReadFile(p)
+		if err != nil {
+			continue
+		}
+		c, err := strconv.ParseInt(strings.TrimSpace(string(b)), 10, 64)
+		if err != nil {
+			continue
+		}
+		capacity[cpu] = c
+	}
+	return capacity
+}
+
+func readCPUList(path string) ([]int, error) {
+	b, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	return ParseCPUList(strings.TrimSpace(string(b)))
+}
+
+// CoreTypes returns the CPU numbers of the performance and the efficiency
+// cores of a hybrid CPU. Intel lists them in /sys/devices/cpu_core and
+// /sys/devices/cpu_atom. On arm64 they are told apart by cpu_capacity, or by
+// the clusters decoded from /proc/cpuinfo where the kernel does not expose
+// it.
+func CoreTypes() (performance, efficiency []int, err error) {
+	performance, err = readCPUList("/sys/devices/cpu_core/cpus")
+	if err == nil {
+		efficiency, err = readCPUList("/sys/devices/cpu_atom/cpus")
+		if err != nil {
+			return nil, nil, fmt.Errorf("no efficiency cores: %w", err)
+		}
+		return performance, efficiency, nil
+	}
+
+	if capacity := readCapacities(); len(capacity) > 0 {
+		return coreTypesCapacity(capacity)
+	}
+
+	f, err := os.Open("/proc/cpuinfo")
+	if err != nil {
+		return nil, nil, err
+	}
+	defer f.Close()
+	blocks, err := cpuinfoBlocks(f)
+	if err != nil {
+		return nil, nil, err
+	}
+	if !anyHasKey(blocks, "CPU part") {
+		return nil, nil, fmt.Errorf("not a hybrid CPU")
+	}
+	return coreTypesARM(blocks)
 }
 
 // parseHexField parses a hexadecimal (or 0x-prefixed) /proc/cpuinfo value.
@@ -288,3 +416,49 @@ func Misc() (string, error) {
 		stringOrNone(run("systemd-detect-virt", "--container")),
 	), nil
 }
+
+// filesystemMagics names the statfs f_type of common filesystems.
+var filesystemMagics = map[uint32]string{
+	0xef53:     "ext4", // also ext2 and ext3
+	0x58465342: "xfs",
+	0x9123683e: "btrfs",
+	0x2fc12fc1: "zfs",
+	0xf2f52010: "f2fs",
+	0xca451a4e: "bcachefs",
+	0x01021994: "tmpfs",
+	0x858458f6: "ramfs",
+	0x794c7630: "overlayfs",
+	0x6969:     "nfs",
+	0xff534d42: "cifs",
+	0xfe534d42: "smb2",
+	0x01021997: "9p",
+	0x65735546: "fuse",
+	0x4d44:     "vfat",
+	0x2011bab0: "exfat",
+	0x5346544e: "ntfs",
+	0x73717368: "squashfs",
+}
+
+// Filesystem returns the type of the filesystem that holds path.
+func Filesystem(path string) (string, error) {
+	var st syscall.Statfs_t
+	err := syscall.Statfs(path, &st)
+	if err != nil {
+		return "", err
+	}
+	if name, ok := filesystemMagics[uint32(st.Type)]; ok {
+		return name, nil
+	}
+	return fmt.Sprintf("0x%x", st.Type), nil
+}
+
+// DiskFree returns the bytes available to unprivileged users on the
+// filesystem that holds path.
+func DiskFree(path string) (int64, error) {
+	var st syscall.Statfs_t
+	err := syscall.Statfs(path, &st)
+	if err != nil {
+		return -1, err
+	}
+	return int64(st.Bavail) * int64(st.Bsize), nil
+}
@@ -1,6 +1,7 @@
 package systemdetect
 
 import (
+	"reflect"
 	"strings"
 	"testing"
 )
@@ -176,3 +177,33 @@ func TestParseCpuinfoEmpty(t *testing.T) {
 		t.Error("expected error for empty /proc/cpuinfo")
 	}
 }
+
+func TestCoreTypesARM(t *testing.T) {
+	blocks, err := cpuinfoBlocks(strings.NewReader(snapdragon888Cpuinfo))
+	if err != nil {
+		t.Fatal(err)
+	}
+	performance, efficiency, err := coreTypesARM(blocks)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// The Cortex-A78 cores of the middle cluster are of neither type.
+	if !reflect.DeepEqual(performance, []int{0}) || !reflect.DeepEqual(efficiency, []int{2, 3, 4, 5}) {
+		t.Errorf("got performance %v, efficiency %v", performance, efficiency)
+	}
+}
+
+func TestCoreTypesCapacity(t *testing.T) {
+	capacity := map[int]int64{0: 1024, 1: 870, 2: 325, 3: 325, 4: 325, 5: 325, 6: 870, 7: 870}
+	performance, efficiency, err := coreTypesCapacity(capacity)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(performance, []int{0}) || !reflect.DeepEqual(efficiency, []int{2, 3, 4, 5}) {
+		t.Errorf("got performance %v, efficiency %v", performance, efficiency)
+	}
+
+	if _, _, err := coreTypesCapacity(map[int]int64{0: 1024, 1: 1024}); err == nil {
+		t.Error("expected error for cores of one capacity")
+	}
+}
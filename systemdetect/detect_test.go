@@ -3,6 +3,7 @@ package systemdetect
 import (
 	"bytes"
 	"log"
+	"reflect"
 	"strings"
 	"testing"
 )
@@ -37,6 +38,22 @@ func TestMisc(t *testing.T) {
 	log.Println("detected misc:", misc)
 }
 
+func TestFilesystem(t *testing.T) {
+	fs, err := Filesystem(".")
+	if err != nil {
+		t.Fatal("cannot get filesystem information")
+	}
+	log.Println("detected filesystem:", fs)
+}
+
+func TestDiskFree(t *testing.T) {
+	free, err := DiskFree(".")
+	if err != nil {
+		t.Fatal("cannot get free disk space")
+	}
+	log.Println("detected free disk space:", free)
+}
+
 func TestKeyValueGet(t *testing.T) {
 	const etcOsRelease = `NAME="foo bar"
 PRETTY_NAME="hello world"
@@ -52,3 +69,23 @@ ID=hi
 		t.Errorf("unexpected value %q", value)
 	}
 }
+
+func TestCPUList(t *testing.T) {
+	cpus, err := ParseCPUList("0-3,8,10-11")
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []int{0, 1, 2, 3, 8, 10, 11}
+	if !reflect.DeepEqual(cpus, want) {
+		t.Errorf("got %v, want %v", cpus, want)
+	}
+	if s := FormatCPUList(cpus); s != "0-3,8,10-11" {
+		t.Errorf("FormatCPUList: got %q", s)
+	}
+
+	for _, bad := range []string{"", "a", "3-1", "1-"} {
+		if _, err := ParseCPUList(bad); err == nil {
+			t.Errorf("ParseCPUList(%q): expected an error", bad)
+		}
+	}
+}
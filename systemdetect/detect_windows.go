@@ -2,6 +2,7 @@ package systemdetect
 
 import (
 	"fmt"
+	"path/filepath"
 	"runtime"
 	"strconv"
 	"strings"
@@ -121,3 +122,43 @@ func osName() string {
 	}
 	return name
 }
+
+// Filesystem returns the type of the filesystem of the volume that holds path,
+// such as "NTFS" or "ReFS".
+func Filesystem(path string) (string, error) {
+	abs, err := filepath.Abs(path)
+	if err != nil {
+		return "", err
+	}
+	root, err := windows.UTF16PtrFromString(filepath.VolumeName(abs) + `\`)
+	if err != nil {
+		return "", err
+	}
+	var name [windows.MAX_PATH + 1]uint16
+	err = windows.GetVolumeInformation(root, nil, 0, nil, nil, nil, &name[0], uint32(len(name)))
+	if err != nil {
+		return "", err
+	}
+	return windows.UTF16ToString(name[:]), nil
+}
+
+// DiskFree returns the bytes available to the current user on the volume that
+// holds path.
+func DiskFree(path string) (int64, error) {
+	p, err := windows.UTF16PtrFromString(path)
+	if err != nil {
+		return -1, err
+	}
+	var avail, total, free uint64
+	err = windows.GetDiskFreeSpaceEx(p, &avail, &total, &free)
+	if err != nil {
+		return -1, err
+	}
+	return int64(avail), nil
+}
+
+// CoreTypes is only implemented on Linux, where the build can be pinned to
+// one type of core.
+func CoreTypes() (performance, efficiency []int, err error) {
+	return nil, nil, fmt.Errorf("core types are not detected on Windows")
+}
@@ -0,0 +1,103 @@
+package main
+
+import "fmt"
+
+// throttleDrop is how far the frequency of the busy CPUs at the end of a build
+// may fall below that at its start before the build is considered throttled.
+const throttleDrop = 0.15
+
+// ThermalTimeline is the CPU frequency and temperature over a build.
+type ThermalTimeline struct {
+	Points []ThermalPoint `json:"points"`
+
+	// MaxFreq is the highest frequency any CPU is rated for, in MHz.
+	MaxFreq float64 `json:"max_freq,omitempty"`
+	// PeakTemp is the highest temperature of any thermal zone in °C, and
+	// PeakZone the type of that zone.
+	PeakTemp float64 `json:"peak_temp,omitempty"`
+	PeakZone string  `json:"peak_zone,omitempty"`
+	// ThrottleEvents is how often the CPUs reported thermal throttling
+	// during the build. Only x86 exposes these counters.
+	ThrottleEvents int64 `json:"throttle_events,omitempty"`
+	// Throttled is the verdict, and Verdict explains it.
+	Throttled bool   `json:"throttled"`
+	Verdict   string `json:"verdict"`
+}
+
+// ThermalPoint is the state at T seconds since the start of the build.
+type ThermalPoint struct {
+	T float64 `json:"t"`
+	// AvgFreq and MinFreq are the mean and lowest current frequency over all
+	// CPUs, in MHz.
+	AvgFreq float64 `json:"avg_freq,omitempty"`
+	MinFreq float64 `json:"min_freq,omitempty"`
+	// BusyFreq is the current frequency averaged over the CPUs weighted by
+	// their utilization since the previous point, in MHz. It is zero when
+	// the CPUs were nearly idle.
+	BusyFreq float64 `json:"busy_freq,omitempty"`
+	// Temp is the temperature of the hottest thermal zone, in °C.
+	Temp float64 `json:"temp,omitempty"`
+}
+
+// judge decides whether the build was throttled. Throttle counters are
+// conclusive; without them, a sustained drop in the frequency of the busy
+// CPUs from the first to the last quarter of the build is taken as
+// throttling. Idle CPUs clock down on their own, so their frequency says
+// nothing about throttling, e.g. during the serial link at the end.
+func (tl *ThermalTimeline) judge() {
+	if tl.ThrottleEvents > 0 {
+		tl.Throttled = true
+		tl.Verdict = fmt.Sprintf("throttled: %d thermal throttling events", tl.ThrottleEvents)
+		return
+	}
+
+	var freqs []float64
+	for _, p := range tl.Points {
+		if p.BusyFreq > 0 {
+			freqs = append(freqs, p.BusyFreq)
+		}
+	}
+	if len(freqs) < 8 {
+		tl.Verdict = "unknown: not enough frequency samples"
+		return
+	}
+	q := len(freqs) / 4
+	first, last := mean(freqs[:q]), mean(freqs[len(freqs)-q:])
+	drop := 1 - last/first
+	if drop > throttleDrop {
+		tl.Throttled = true
+		tl.Verdict = fmt.Sprintf("likely throttled: busy CPU frequency fell %.0f%% from %.0f MHz to %.0f MHz", 100*drop, first, last)
+		return
+	}
+	tl.Verdict = "no throttling detected"
+}
+
+func mean(xs []float64) float64 {
+	sum := 0.0
+	for _, x := range xs {
+		sum += x
+	}
+	return sum / float64(len(xs))
+}
+
+func printThermalTimeline(tl *ThermalTimeline) {
+	var freqs []float64
+	for _, p := range tl.Points {
+		if p.AvgFreq > 0 {
+			freqs = append(freqs, p.AvgFreq)
+		}
+	}
+
+	fmt.Println("frequency and temperature:")
+	if len(freqs) > 0 {
+		fmt.Printf("  average frequency: %.0f MHz", mean(freqs))
+		if tl.MaxFreq > 0 {
+			fmt.Printf(" (max %.0f MHz)", tl.MaxFreq)
+		}
+		fmt.Println()
+	}
+	if tl.PeakZone != "" {
+		fmt.Printf("  peak temperature:  %.0f°C (%s)\n", tl.PeakTemp, tl.PeakZone)
+	}
+	fmt.Printf("  throttling:        %s\n", tl.Verdict)
+}
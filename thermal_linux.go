@@ -0,0 +1,230 @@
+package main
+
+import (
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// readSysInt reads a sysfs file holding a single integer.
+func readSysInt(path string) (int64, error) {
+	b, err := os.ReadFile(path)
+	if err != nil {
+		return 0, err
+	}
+	return strconv.ParseInt(strings.TrimSpace(string(b)), 10, 64)
+}
+
+// sumSysInts returns the sum of the integers in paths, skipping unreadable
+// ones.
+func sumSysInts(paths []string) int64 {
+	var sum int64
+	for _, p := range paths {
+		n, err := readSysInt(p)
+		if err == nil {
+			sum += n
+		}
+	}
+	return sum
+}
+
+type thermalZone struct {
+	name string
+	temp string // path of the temperature in millidegrees Celsius
+}
+
+// cpuFreq is the current frequency file of one CPU.
+type cpuFreq struct {
+	cpu  int
+	path string // scaling_cur_freq, in kHz
+}
+
+// minBusy is how many CPUs' worth of utilization a point needs for its busy
+// frequency to be recorded.
+const minBusy = 0.5
+
+// busyFreq averages freqs, in MHz by CPU number, weighted by each CPU's
+// utilization between prev and cur. It returns 0 if the CPUs were busy for
+// less than minBusy CPUs in total.
+func busyFreq(freqs map[int]float64, prev, cur *procStat) float64 {
+	prevTimes := make(map[int]cpuTimes, len(prev.cpus))
+	for i, id := range prev.ids {
+		prevTimes[id] = prev.cpus[i]
+	}
+	var sum, weight float64
+	for i, id := range cur.ids {
+		f, ok := freqs[id]
+		p, ok2 := prevTimes[id]
+		if !ok || !ok2 {
+			continue
+		}
+		u := cur.cpus[i].utilization(p)
+		sum += u * f
+		weight += u
+	}
+	if weight < minBusy {
+		return 0
+	}
+	return sum / weight
+}
+
+// thermalMonitor samples cpufreq and the thermal zones in sysfs.
+type thermalMonitor struct {
+	freqs     []cpuFreq
+	prev      *procStat // for the utilization of each CPU; nil if unreadable
+	zones     []thermalZone
+	throttles []string // x86 thermal_throttle counters
+	throttle0 int64
+
+	tl *ThermalTimeline
+}
+
+// cpuNumber returns N for a path below /sys/devices/system/cpu/cpuN.
+func cpuNumber(path string) (int, bool) {
+	rest, ok := strings.CutPrefix(path, "/sys/devices/system/cpu/cpu")
+	if !ok {
+		return 0, false
+	}
+	n, _, _ := strings.Cut(rest, "/")
+	id, err := strconv.Atoi(n)
+	return id, err == nil
+}
+
+// packageThrottles returns one package_throttle_count per physical package;
+// every CPU of a package exposes the same counter.
+func packageThrottles() []string {
+	paths, _ := filepath.Glob("/sys/devices/system/cpu/cpu[0-9]*/thermal_throttle/package_throttle_count")
+	seen := make(map[int64]bool)
+	var pkgs []string
+	for _, p := range paths {
+		cpu := filepath.Dir(filepath.Dir(p))
+		id, err := readSysInt(filepath.Join(cpu, "topology", "physical_package_id"))
+		if err == nil {
+			if seen[id] {
+				continue
+			}
+			seen[id] = true
+		}
+		pkgs = append(pkgs, p)
+	}
+	return pkgs
+}
+
+func newThermalMonitor() monitor {
+	m := &thermalMonitor{tl: &ThermalTimeline{}}
+	paths, _ := filepath.Glob("/sys/devices/system/cpu/cpu[0-9]*/cpufreq/scaling_cur_freq")
+	for _, p := range paths {
+		if cpu, ok := cpuNumber(p); ok {
+			m.freqs = append(m.freqs, cpuFreq{cpu: cpu, path: p})
+		}
+	}
+	m.prev, _ = readProcStat()
+	maxFreqs, _ := filepath.Glob("/sys/devices/system/cpu/cpu[0-9]*/cpufreq/cpuinfo_max_freq")
+	for _, p := range maxFreqs {
+		if f, err := readSysInt(p); err == nil && float64(f)/1000 > m.tl.MaxFreq {
+			m.tl.MaxFreq = float64(f) / 1000
+		}
+	}
+
+	zones, _ := filepath.Glob("/sys/class/thermal/thermal_zone[0-9]*")
+	for _, z := range zones {
+		name, err := os.ReadFile(filepath.Join(z, "type"))
+		if err != nil {
+			continue
+		}
+		m.zones = append(m.zones, thermalZone{
+			name: strings.TrimSpace(string(name)),
+			temp: filepath.Join(z, "temp"),
+		})
+	}
+
+	core, _ := filepath.Glob("/sys/devices/system/cpu/cpu[0-9]*/thermal_throttle/core_throttle_count")
+	m.throttles = append(core, packageThrottles()...)
+	m.throttle0 = sumSysInts(m.throttles)
+
+	if len(m.freqs) == 0 && len(m.zones) == 0 {
+		log.Println("not monitoring cpu frequency and temperature: not exposed in sysfs")
+		return nil
+	}
+	return m
+}
+
+func (m *thermalMonitor) sample(t time.Duration) {
+	p := ThermalPoint{T: t.Seconds()}
+
+	var sum float64
+	freqs := make(map[int]float64, len(m.freqs))
+	for _, cf := range m.freqs {
+		f, err := readSysInt(cf.path)
+		if err != nil {
+			continue
+		}
+		mhz := float64(f) / 1000
+		sum += mhz
+		if len(freqs) == 0 || mhz < p.MinFreq {
+			p.MinFreq = mhz
+		}
+		freqs[cf.cpu] = mhz
+	}
+	if len(freqs) > 0 {
+		p.AvgFreq = sum / float64(len(freqs))
+	}
+	if m.prev != nil {
+		if st, err := readProcStat(); err == nil {
+			p.BusyFreq = busyFreq(freqs, m.prev, st)
+			m.prev = st
+		}
+	}
+
+	for _, z := range m.zones {
+		mc, err := readSysInt(z.temp)
+		if err != nil {
+			continue
+		}
+		c := float64(mc) / 1000
+		if c > p.Temp {
+			p.Temp = c
+		}
+		if c > m.tl.PeakTemp {
+			m.tl.PeakTemp = c
+			m.tl.PeakZone = z.name
+		}
+	}
+
+	m.tl.Points = append(m.tl.Points, p)
+}
+
+func (m *thermalMonitor) finish(s *Sample) {
+	m.tl.ThrottleEvents = sumSysInts(m.throttles) - m.throttle0
+	m.tl.judge()
+	s.Thermal = m.tl
+}
+
+// detectThermal describes the current CPU frequency and hottest thermal zone
+// for --detect, or returns "" if sysfs exposes neither.
+func detectThermal() string {
+	mon := newThermalMonitor()
+	if mon == nil {
+		return ""
+	}
+	m := mon.(*thermalMonitor)
+	m.sample(0)
+	p := m.tl.Points[0]
+
+	var parts []string
+	if p.AvgFreq > 0 {
+		s := fmt.Sprintf("%.0f MHz average", p.AvgFreq)
+		if m.tl.MaxFreq > 0 {
+			s += fmt.Sprintf(" (max %.0f MHz)", m.tl.MaxFreq)
+		}
+		parts = append(parts, s)
+	}
+	if m.tl.PeakZone != "" {
+		parts = append(parts, fmt.Sprintf("%.0f°C (%s)", m.tl.PeakTemp, m.tl.PeakZone))
+	}
+	return strings.Join(parts, ", ")
+}
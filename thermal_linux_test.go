@@ -0,0 +1,39 @@
+package main
+
+import "testing"
+
+func TestBusyFreq(t *testing.T) {
+	prev := &procStat{
+		cpus: []cpuTimes{{idle: 0, total: 0}, {idle: 0, total: 0}, {idle: 0, total: 0}},
+		ids:  []int{0, 1, 3},
+	}
+	// CPU 0 fully busy at 4000 MHz, CPU 1 idle at 800 MHz, CPU 3 half busy
+	// at 3000 MHz.
+	cur := &procStat{
+		cpus: []cpuTimes{{idle: 0, total: 100}, {idle: 100, total: 100}, {idle: 50, total: 100}},
+		ids:  []int{0, 1, 3},
+	}
+	freqs := map[int]float64{0: 4000, 1: 800, 3: 3000}
+	want := (4000 + 0.5*3000) / 1.5
+	if got := busyFreq(freqs, prev, cur); got != want {
+		t.Errorf("busyFreq = %v, want %v", got, want)
+	}
+
+	idle := &procStat{
+		cpus: []cpuTimes{{idle: 90, total: 100}, {idle: 100, total: 100}, {idle: 100, total: 100}},
+		ids:  []int{0, 1, 3},
+	}
+	if got := busyFreq(freqs, prev, idle); got != 0 {
+		t.Errorf("busyFreq of idle CPUs = %v, want 0", got)
+	}
+}
+
+func TestCPUNumber(t *testing.T) {
+	id, ok := cpuNumber("/sys/devices/system/cpu/cpu12/cpufreq/scaling_cur_freq")
+	if !ok || id != 12 {
+		t.Errorf("cpuNumber = %d, %v, want 12, true", id, ok)
+	}
+	if _, ok := cpuNumber("/sys/devices/system/cpu/cpufreq/policy0"); ok {
+		t.Error("cpuNumber accepted a path outside cpuN")
+	}
+}
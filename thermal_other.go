@@ -0,0 +1,9 @@
+//go:build !linux
+
+package main
+
+// detectThermal returns "": frequency and temperature are only read from
+// Linux's sysfs.
+func detectThermal() string {
+	return ""
+}
@@ -0,0 +1,37 @@
+package main
+
+import "testing"
+
+func TestThermalJudge(t *testing.T) {
+	points := func(freqs ...float64) []ThermalPoint {
+		ps := make([]ThermalPoint, len(freqs))
+		for i, f := range freqs {
+			ps[i] = ThermalPoint{T: float64(i), AvgFreq: f, BusyFreq: f}
+		}
+		return ps
+	}
+
+	// A serial link leaves most CPUs idle at low clocks; only the busy one
+	// counts.
+	idleTail := points(4000, 4000, 4000, 4000, 4000, 4000, 4000, 4000)
+	for i := 6; i < len(idleTail); i++ {
+		idleTail[i].AvgFreq = 1200
+	}
+
+	for _, tc := range []struct {
+		name      string
+		tl        ThermalTimeline
+		throttled bool
+	}{
+		{"steady", ThermalTimeline{Points: points(4000, 4000, 3900, 3950, 3900, 3900, 3950, 3900)}, false},
+		{"drop", ThermalTimeline{Points: points(4000, 4000, 3500, 3000, 3000, 2800, 2800, 2800)}, true},
+		{"counters", ThermalTimeline{Points: points(4000), ThrottleEvents: 3}, true},
+		{"too short", ThermalTimeline{Points: points(4000, 2000)}, false},
+		{"idle at the end", ThermalTimeline{Points: idleTail}, false},
+	} {
+		tc.tl.judge()
+		if tc.tl.Throttled != tc.throttled {
+			t.Errorf("%s: throttled = %v, want %v (%s)", tc.name, tc.tl.Throttled, tc.throttled, tc.tl.Verdict)
+		}
+	}
+}
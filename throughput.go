@@ -0,0 +1,139 @@
+package main
+
+import (
+	"fmt"
+	"log"
+	"slices"
+	"sync"
+	"time"
+
+	"github.com/spf13/pflag"
+)
+
+var throughputBuilds int
+
+func init() {
+	pflag.IntVar(&throughputBuilds, "throughput", 0, "run this many builds side by side, each in its own tree, and report the builds per hour of the machine")
+}
+
+// Throughput is the result of --throughput: Builds builds of the track run
+// side by side, each in its own cmake tree, --runs times.
+type Throughput struct {
+	Builds int `json:"builds"`
+	// Wall is the median time in seconds from starting the builds of a round
+	// until the last of them finished.
+	Wall float64 `json:"wall"`
+	// BuildsPerHour is how many builds the machine completes in an hour when
+	// it runs Builds of them at a time.
+	BuildsPerHour float64 `json:"builds_per_hour"`
+	// Times summarizes the time of every single build, and Fastest and
+	// Slowest are the extremes; the spread between them shows how evenly the
+	// machine shares itself between the builds.
+	Times   Stats   `json:"times"`
+	Fastest float64 `json:"fastest"`
+	Slowest float64 `json:"slowest"`
+	// Rounds hold the wall time of each round and what the monitors saw of
+	// the whole machine during it.
+	Rounds []*Sample `json:"rounds"`
+}
+
+// newThroughput summarizes rounds of k builds side by side. walls are the
+// wall times of the rounds and times those of every build in them.
+func newThroughput(k int, walls, times []float64) *Throughput {
+	wall := median(walls)
+	return &Throughput{
+		Builds:        k,
+		Wall:          wall,
+		BuildsPerHour: float64(k) * 3600 / wall,
+		Times:         summarize(times),
+		Fastest:       slices.Min(times),
+		Slowest:       slices.Max(times),
+	}
+}
+
+// measureThroughput configures throughputBuilds-1 more trees next to b's,
+// from the same extracted packages, then --runs times builds targets in all
+// of them at once. The submitted time is the median round's wall time
+// divided by the number of builds, so that the builds per hour printed for
+// it are those of the whole machine.
+func measureThroughput(b *builder, targets []string, r *Result) error {
+	k := throughputBuilds
+	trees := []*builder{b}
+	for i := 1; i < k; i++ {
+		tree := *b
+		tree.out = fmt.Sprintf("%s.%d", b.out, i+1)
+		log.Printf("throughput: configuring tree %d of %d", i+1, k)
+		err := timed(&r.Phases.ThroughputConfigure, func() error {
+			return tree.configure(tree.out)
+		})
+		if err != nil {
+			return err
+		}
+		trees = append(trees, &tree)
+	}
+
+	var walls, times []float64
+	var rounds []*Sample
+	for round := 0; round < runs; round++ {
+		// Only the ninja runs are timed; cleaning and preparing the trees
+		// before and profiling them after would skew the builds that
+		// start or finish first.
+		builds := make([]*ninjaBuild, k)
+		for i, tree := range trees {
+			if tree.built {
+				err := tree.clean()
+				if err != nil {
+					return err
+				}
+			}
+			var err error
+			builds[i], err = tree.prepareBuild(targets, 0)
+			if err != nil {
+				return err
+			}
+		}
+
+		log.Printf("throughput: starting %d builds side by side", k)
+		samples := make([]*Sample, k)
+		errs := make([]error, k)
+		var wg sync.WaitGroup
+		stop := watch(monitors(b), sampleInterval)
+		t0 := time.Now()
+		for i, nb := range builds {
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				samples[i], errs[i] = nb.run()
+			}()
+		}
+		wg.Wait()
+		all := &Sample{Time: time.Since(t0).Seconds()}
+		stop(all)
+		walls = append(walls, all.Time)
+		rounds = append(rounds, all)
+
+		for i, s := range samples {
+			if errs[i] != nil {
+				log.Printf("throughput: build %d failed", i+1)
+				return errs[i]
+			}
+			builds[i].profile(s)
+			s.Name = fmt.Sprintf("tree %d", i+1)
+			r.Samples = append(r.Samples, s)
+			times = append(times, s.Time)
+		}
+	}
+
+	r.Throughput = newThroughput(k, walls, times)
+	r.Throughput.Rounds = rounds
+	r.Time = r.Throughput.Wall / float64(k)
+	return nil
+}
+
+func printThroughput(t *Throughput) {
+	fmt.Printf("throughput of %d builds side by side:\n", t.Builds)
+	fmt.Printf("  wall time:       %.1fs\n", t.Wall)
+	fmt.Printf("  builds per hour: %.1f\n", t.BuildsPerHour)
+	fmt.Printf("  single builds:   fastest %.1fs  median %.1fs  slowest %.1fs (spread %.1f%%)\n",
+		t.Fastest, t.Times.Median, t.Slowest, 100*(t.Slowest-t.Fastest)/t.Fastest)
+}
@@ -0,0 +1,19 @@
+package main
+
+import "testing"
+
+func TestNewThroughput(t *testing.T) {
+	tp := newThroughput(2, []float64{120, 100, 110}, []float64{90, 100, 95, 120, 80, 110})
+	if tp.Wall != 110 {
+		t.Errorf("wall: got %v, want 110", tp.Wall)
+	}
+	if tp.BuildsPerHour != 2*3600/110.0 {
+		t.Errorf("builds per hour: got %v", tp.BuildsPerHour)
+	}
+	if tp.Fastest != 80 || tp.Slowest != 120 {
+		t.Errorf("fastest %v, slowest %v; want 80 and 120", tp.Fastest, tp.Slowest)
+	}
+	if tp.Times.Median != 97.5 {
+		t.Errorf("median: got %v, want 97.5", tp.Times.Median)
+	}
+}
@@ -0,0 +1,81 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"time"
+
+	"github.com/spf13/pflag"
+)
+
+var (
+	downloadTimeout  time.Duration
+	extractTimeout   time.Duration
+	configureTimeout time.Duration
+	buildTimeout     time.Duration
+	stallTimeout     time.Duration
+)
+
+func init() {
+	pflag.DurationVar(&downloadTimeout, "download-timeout", 0, "fail if downloading a package takes longer than this; 0 means no limit")
+	pflag.DurationVar(&extractTimeout, "extract-timeout", 0, "fail if extracting a package takes longer than this; 0 means no limit")
+	pflag.DurationVar(&configureTimeout, "configure-timeout", 0, "fail if a cmake configure takes longer than this; 0 means no limit")
+	pflag.DurationVar(&buildTimeout, "build-timeout", 0, "fail if a single build takes longer than this; 0 means no limit")
+	pflag.DurationVar(&stallTimeout, "stall-timeout", 0, "fail if ninja finishes no build step for this long; 0 means no limit")
+}
+
+// phaseContext returns ctx with a deadline d from now, unless d is 0. When
+// the deadline passes, context.Cause names the phase and its flag.
+func phaseContext(ctx context.Context, phase string, d time.Duration) (context.Context, context.CancelFunc) {
+	if d <= 0 {
+		return context.WithCancel(ctx)
+	}
+	return context.WithTimeoutCause(ctx, d, fmt.Errorf("%s did not finish within %v (--%s-timeout)", phase, d, phase))
+}
+
+// phaseError returns why ctx is done in place of err, so that a command
+// killed by a timeout fails with the timeout rather than "signal: killed".
+func phaseError(ctx context.Context, err error) error {
+	if err != nil && ctx.Err() != nil {
+		return context.Cause(ctx)
+	}
+	return err
+}
+
+// watchProgress cancels ctx when size, the size of .ninja_log, which ninja
+// appends to whenever a step finishes, has not grown for timeout. It returns
+// a function that stops watching.
+func watchProgress(ctx context.Context, cancel context.CancelCauseFunc, size func() (int64, error), timeout time.Duration) (stop func()) {
+	if timeout <= 0 {
+		return func() {}
+	}
+	done := make(chan struct{})
+	go func() {
+		ticker := time.NewTicker(min(timeout/10, 10*time.Second))
+		defer ticker.Stop()
+		last, _ := size()
+		progress := time.Now()
+		for {
+			select {
+			case <-done:
+				return
+			case <-ctx.Done():
+				return
+			case now := <-ticker.C:
+				n, err := size()
+				if err == nil && n != last {
+					last, progress = n, now
+					continue
+				}
+				if now.Sub(progress) >= timeout {
+					err := fmt.Errorf("ninja finished no build step for %v (--stall-timeout)", timeout)
+					log.Println(err)
+					cancel(err)
+					return
+				}
+			}
+		}
+	}()
+	return func() { close(done) }
+}
@@ -0,0 +1,47 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestWatchProgress(t *testing.T) {
+	ctx, cancel := context.WithCancelCause(context.Background())
+	defer cancel(nil)
+	stop := watchProgress(ctx, cancel, func() (int64, error) { return 42, nil }, 50*time.Millisecond)
+	defer stop()
+
+	select {
+	case <-ctx.Done():
+	case <-time.After(5 * time.Second):
+		t.Fatal("watchdog did not fire")
+	}
+	if cause := context.Cause(ctx); !strings.Contains(cause.Error(), "--stall-timeout") {
+		t.Errorf("cause: %v", cause)
+	}
+}
+
+func TestWatchProgressGrowing(t *testing.T) {
+	ctx, cancel := context.WithCancelCause(context.Background())
+	defer cancel(nil)
+	var n int64
+	stop := watchProgress(ctx, cancel, func() (int64, error) { n++; return n, nil }, 50*time.Millisecond)
+	time.Sleep(200 * time.Millisecond)
+	stop()
+	if ctx.Err() != nil {
+		t.Errorf("watchdog fired although the log grew: %v", context.Cause(ctx))
+	}
+}
+
+func TestPhaseError(t *testing.T) {
+	ctx, cancel := phaseContext(context.Background(), "configure", time.Nanosecond)
+	defer cancel()
+	<-ctx.Done()
+	err := phaseError(ctx, errors.New("signal: killed"))
+	if err == nil || !strings.Contains(err.Error(), "--configure-timeout") {
+		t.Errorf("got %v", err)
+	}
+}
@@ -0,0 +1,300 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/spf13/pflag"
+)
+
+var (
+	quick     bool
+	trackName string
+)
+
+func init() {
+	pflag.BoolVar(&quick, "quick", false, "do a quick build to check configuration; same as --track quick")
+	pflag.StringVar(&trackName, "track", "standard", "what to build and time: "+strings.Join(trackNames(), ", "))
+}
+
+// Track is what the benchmark builds and how it times it.
+type Track struct {
+	// Targets are the ninja targets that get built.
+	Targets []string
+	// CmakeArgs are added to the cmake configure command. ${tool} expands to
+	// the path of tool in the toolchain's bin directory.
+	CmakeArgs []string
+	// Source lists keepPaths patterns for the parts of the llvm-project
+	// source tree the track needs beyond those of llvmSrcKeep.
+	Source []string
+	// MinFree is the free disk space in bytes the build directory needs;
+	// the benchmark refuses to start with less. 0 means no check.
+	MinFree int64
+	// Measure runs the timed builds in a configured tree and stores the
+	// samples and the submitted time in r. nil means timing --runs clean
+	// builds of Targets.
+	Measure func(b *builder, t *Track, r *Result) error
+}
+
+// These sources are touched by the incremental track, relative to the llvm/
+// source directory. Instructions.h is included by most of the IR and CodeGen
+// libraries llc links; llc.cpp is only part of llc itself.
+const (
+	incrementalHeader = "include/llvm/IR/Instructions.h"
+	incrementalLeaf   = "tools/llc/llc.cpp"
+)
+
+var tracks = map[string]*Track{
+	"quick": {
+		Targets: []string{"llvm-cxxfilt"},
+	},
+	"standard": {
+		Targets: []string{"llc"},
+	},
+	"incremental": {
+		Targets: []string{"llc"},
+		Measure: measureIncremental,
+	},
+	// clang builds the whole compiler and linker rather than one of LLVM's
+	// tools, which takes several times longer than llc, so that it can tell
+	// apart machines that build llc in a couple of minutes. lld needs the
+	// libunwind headers for its Mach-O port.
+	"clang": {
+		Targets: []string{"clang", "lld"},
+		CmakeArgs: []string{
+			"-DLLVM_ENABLE_PROJECTS=clang;lld",
+			"-DCLANG_TABLEGEN=${clang-tblgen}",
+		},
+		Source: []string{"clang/", "lld/", "libunwind/include/"},
+	},
+	// debug builds llc with debug info, which makes the build write and link
+	// several times more data and so stresses the disk and the linker rather
+	// than the compiler's optimizer. Split DWARF keeps the debug info out of
+	// the link, as most developers building with it would.
+	"debug": {
+		Targets: []string{"llc"},
+		CmakeArgs: []string{
+			"-DCMAKE_BUILD_TYPE=RelWithDebInfo",
+			"-DLLVM_USE_SPLIT_DWARF=ON",
+		},
+		MinFree: 20 << 30,
+	},
+	// thinlto builds llc the way release builds are made. The compiles only
+	// emit bitcode and most of the code generation moves into the final link,
+	// where lld runs it on all threads, so the link of bin/llc dominates and
+	// depends on memory bandwidth and lld's thread scaling. LLVM only gives
+	// lld a ThinLTO cache when LLVM_USE_LINKER is set, which it is not, so
+	// every build redoes the whole link.
+	"thinlto": {
+		Targets: []string{"llc"},
+		CmakeArgs: []string{
+			"-DLLVM_ENABLE_LTO=Thin",
+		},
+	},
+	"link": {
+		Targets: []string{"llc"},
+		Measure: measureLink,
+	},
+	// unity builds llc from a few large translation units instead of many
+	// small ones, which leaves fewer compiles to run in parallel and needs
+	// more memory for each.
+	"unity": {
+		Targets: []string{"llc"},
+		CmakeArgs: []string{
+			"-DCMAKE_UNITY_BUILD=ON",
+		},
+		Measure: measureUnity,
+	},
+}
+
+func trackNames() []string {
+	names := make([]string, 0, len(tracks))
+	for name := range tracks {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+func getTrack() (name string, t *Track) {
+	name = trackName
+	if quick {
+		name = "quick"
+	}
+	t, ok := tracks[name]
+	if !ok {
+		log.Fatalf("unknown track: %q", name)
+	}
+	if sweep && t.Measure != nil {
+		log.Fatalf("--sweep cannot be used with --track %s", name)
+	}
+	if throughputBuilds > 1 && t.Measure != nil {
+		log.Fatalf("--throughput cannot be used with --track %s", name)
+	}
+	if throughputBuilds > 1 && sweep {
+		log.Fatal("--throughput cannot be used with --sweep")
+	}
+	return name, t
+}
+
+func (t *Track) measure(b *builder, r *Result) error {
+	if t.Measure != nil {
+		return t.Measure(b, t, r)
+	}
+
+	var err error
+	r.Samples, err = b.timedBuilds(t.Targets, 0, runs)
+	if err != nil {
+		return err
+	}
+	r.Time = median(r.times())
+	return nil
+}
+
+// measureIncremental builds the target in full, then times rebuilding it after
+// touching a widely included header and, separately, a single leaf source
+// file, each --runs times. The submitted time is the sum of the two median
+// rebuild times.
+func measureIncremental(b *builder, t *Track, r *Result) error {
+	log.Println("incremental: full build")
+	s, err := b.cleanBuild(t.Targets, 0)
+	if err != nil {
+		return err
+	}
+	s.Name = "full"
+	r.Samples = append(r.Samples, s)
+
+	r.Time = 0
+	for _, step := range []struct {
+		name, path string
+	}{
+		{"header", incrementalHeader},
+		{"leaf", incrementalLeaf},
+	} {
+		var times []float64
+		for i := 0; i < runs; i++ {
+			log.Printf("incremental: touching %s", step.path)
+			err = touch(b.absPath(filepath.Join(b.c.LLVMSrc, step.path)))
+			if err != nil {
+				return err
+			}
+			s, err := b.timedBuild(t.Targets, 0)
+			if err != nil {
+				return err
+			}
+			s.Name = step.name
+			r.Samples = append(r.Samples, s)
+			times = append(times, s.Time)
+		}
+		r.Time += median(times)
+	}
+	return nil
+}
+
+// measureLink builds the target once without timing it, then deletes only
+// the output of its final link, bin/llc, and times relinking it --runs times.
+// The submitted time is the median duration of the link steps recorded in
+// .ninja_log, which leaves out ninja's own start up.
+func measureLink(b *builder, t *Track, r *Result) error {
+	log.Println("link: untimed build")
+	b.built = true
+	err := b.ninja(t.Targets...)
+	if err != nil {
+		return err
+	}
+	outs, err := b.finalOutputs(t.Targets)
+	if err != nil {
+		log.Println("cannot find the final link outputs:", err)
+		return err
+	}
+
+	var times []float64
+	for i := 0; i < runs; i++ {
+		for _, out := range outs {
+			log.Printf("link: deleting %s", out)
+			err = os.Remove(b.absPath(filepath.Join(b.out, out)))
+			if err != nil {
+				return err
+			}
+		}
+		s, err := b.timedBuild(t.Targets, 0)
+		if err != nil {
+			return err
+		}
+		s.Name = "link"
+		r.Samples = append(r.Samples, s)
+
+		// The wall time of the run would include ninja's start up, so a
+		// run without link steps in its profile is left out rather than
+		// mixed in.
+		if s.Profile == nil || len(s.Profile.Final) == 0 {
+			log.Printf("link: run %d has no link steps in .ninja_log, leaving it out", i+1)
+			continue
+		}
+		link := 0.0
+		for _, f := range s.Profile.Final {
+			link += f.Time
+		}
+		times = append(times, link)
+	}
+	if len(times) == 0 {
+		return errors.New("link: no run recorded its link steps in .ninja_log")
+	}
+	r.Time = median(times)
+	return nil
+}
+
+// measureUnity times --runs unity builds of the target, then configures a
+// second tree without the track's cmake arguments next to the first one and
+// times --runs normal builds there, so that the two can be compared. The
+// submitted time is the median unity build time.
+func measureUnity(b *builder, t *Track, r *Result) error {
+	samples, err := b.timedBuilds(t.Targets, 0, runs)
+	if err != nil {
+		return err
+	}
+	unity := median(times(samples))
+	for _, s := range samples {
+		s.Name = "unity"
+	}
+	r.Samples = append(r.Samples, samples...)
+
+	log.Println("unity: configuring a normal build tree to compare with")
+	normal := *b
+	normal.t = &Track{Targets: t.Targets}
+	normal.out = b.out + ".normal"
+	err = timed(&r.Phases.NormalConfigure, func() error {
+		return normal.configure(normal.out)
+	})
+	if err != nil {
+		return err
+	}
+	samples, err = normal.timedBuilds(t.Targets, 0, runs)
+	if err != nil {
+		return err
+	}
+	for _, s := range samples {
+		s.Name = "normal"
+	}
+	r.Samples = append(r.Samples, samples...)
+
+	r.Time = unity
+	r.UnityRatio = unity / median(times(samples))
+	return nil
+}
+
+// touch sets the modification time of path to now, like touch(1).
+func touch(path string) error {
+	now := time.Now()
+	err := os.Chtimes(path, now, now)
+	if err != nil {
+		return fmt.Errorf("cannot touch %s: %w", path, err)
+	}
+	return nil
+}